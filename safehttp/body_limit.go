@@ -0,0 +1,84 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"errors"
+	"io"
+	"net/http"
+)
+
+// DefaultMaxBodySize is the maximum size in bytes of request bodies used by
+// ServeMux unless changed with ServeMux.SetMaxBodySize.
+const DefaultMaxBodySize = 10 << 20
+
+// ErrBodyTooLarge is returned when reading a request body larger than the
+// maximum body size of the route serving the request.
+var ErrBodyTooLarge = errors.New("request body too large")
+
+// MaxBodySize overrides the maximum size in bytes of the request bodies of a
+// route. It can be passed as a Config to ServeMux.Handle, e.g. to accept large
+// file uploads on a single route. If it's zero or negative, the size of the
+// request bodies of the route is unlimited.
+type MaxBodySize int64
+
+// Match returns false, since a MaxBodySize doesn't configure any Interceptor.
+// It is needed to pass a MaxBodySize to ServeMux.Handle.
+func (MaxBodySize) Match(Interceptor) bool {
+	return false
+}
+
+// maxBodyReader limits the size of a request body, returning ErrBodyTooLarge
+// once more than max bytes have been read.
+type maxBodyReader struct {
+	rc        io.ReadCloser
+	w         http.ResponseWriter
+	remaining int64
+	err       error
+}
+
+func newMaxBodyReader(w http.ResponseWriter, rc io.ReadCloser, max int64) *maxBodyReader {
+	return &maxBodyReader{rc: rc, w: w, remaining: max}
+}
+
+func (b *maxBodyReader) Read(p []byte) (int, error) {
+	if b.err != nil {
+		return 0, b.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read one byte more than allowed in order to detect bodies that are
+	// exactly at the limit.
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.rc.Read(p)
+	if int64(n) <= b.remaining {
+		b.remaining -= int64(n)
+		b.err = err
+		return n, err
+	}
+	n = int(b.remaining)
+	b.remaining = 0
+	b.err = ErrBodyTooLarge
+	// The rest of the body won't be read, so the connection can't be reused.
+	b.w.Header().Set("Connection", "close")
+	return n, b.err
+}
+
+func (b *maxBodyReader) Close() error {
+	return b.rc.Close()
+}
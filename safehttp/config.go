@@ -20,3 +20,27 @@ type Config interface {
 	// Interceptor.
 	Match(Interceptor) bool
 }
+
+// ValidatedConfig is a Config that can be checked for errors when the handler
+// it's passed with is registered. ServeMux.Handle panics if Validate returns
+// an error, so that invalid configurations are detected at startup rather than
+// when serving requests.
+type ValidatedConfig interface {
+	Config
+	// Validate returns an error if the Config is invalid.
+	Validate() error
+}
+
+// OptionsConfig is a Config whose Interceptor answers OPTIONS requests on
+// its own, e.g. CORS preflight requests. When a handler is registered with an
+// OptionsConfig whose HandleOptions method returns true, the OPTIONS requests
+// of its pattern are dispatched to the interceptors with the Configs of that
+// handler, unless a handler is registered for the OPTIONS method itself. These
+// requests are answered with a 405 Method Not Allowed error if none of the
+// interceptors responds to them.
+type OptionsConfig interface {
+	Config
+	// HandleOptions reports whether the OPTIONS requests of the pattern should
+	// be dispatched to the interceptors.
+	HandleOptions() bool
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+)
+
+// DefaultDispatcher is the Dispatcher used by a ServeMux when none is
+// provided. It only writes responses that are known to be safe:
+//   - safehtml.HTML responses.
+//   - *template.Template templates from github.com/google/safehtml/template.
+//   - JSONResponse responses.
+//
+// HTML is sent with a Content-Type of "text/html; charset=utf-8" and JSON with
+// a Content-Type of "application/json; charset=utf-8". Any other type of
+// response or template is rejected with an error and nothing is written.
+//
+// DefaultDispatcher also supports streamed responses made of safehtml.HTML
+// fragments or of JSONResponse fragments. The latter are sent as JSON lines,
+// with a Content-Type of "application/x-ndjson; charset=utf-8", and the stream
+// is prefixed with the same anti-XSSI prefix as JSON responses.
+type DefaultDispatcher struct{}
+
+// Write writes the response if it is a safehtml.HTML or a JSONResponse and
+// returns an error otherwise.
+func (DefaultDispatcher) Write(rw http.ResponseWriter, resp Response) error {
+	switch x := resp.(type) {
+	case safehtml.HTML:
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := io.WriteString(rw, x.String())
+		return err
+	case JSONResponse:
+		return writeJSON(rw, x)
+	default:
+		return fmt.Errorf("%T is not a safe response type", resp)
+	}
+}
+
+// ExecuteTemplate executes the template if it is a safehtml/template.Template
+// and returns an error otherwise. The template is fully executed before
+// anything is written, so that no partial response is sent if it fails.
+func (DefaultDispatcher) ExecuteTemplate(rw http.ResponseWriter, t Template, data interface{}) error {
+	switch x := t.(type) {
+	case *template.Template:
+		var b bytes.Buffer
+		if err := x.Execute(&b, data); err != nil {
+			return err
+		}
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, err := rw.Write(b.Bytes())
+		return err
+	default:
+		return fmt.Errorf("%T is not a safe template type", t)
+	}
+}
+
+// jsonPrefix is prepended to all JSON responses to prevent them from being
+// evaluated as scripts when included cross-site.
+const jsonPrefix = ")]}'\n"
+
+// writeJSON writes the JSON encoding of resp.Data prefixed by jsonPrefix. The
+// encoding is fully computed before anything is written. Since encoding/json
+// rejects json.Marshaler implementations returning invalid JSON, the response
+// can't be turned into JSONP or any other callback-wrapped script.
+func writeJSON(rw http.ResponseWriter, resp JSONResponse) error {
+	b, err := json.Marshal(resp.Data)
+	if err != nil {
+		return err
+	}
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if _, err := io.WriteString(rw, jsonPrefix); err != nil {
+		return err
+	}
+	_, err = rw.Write(b)
+	return err
+}
+
+// ContentType returns the Content-Type of a stream of safehtml.HTML or
+// JSONResponse fragments and returns an error for any other response type.
+func (DefaultDispatcher) ContentType(resp Response) (string, error) {
+	switch resp.(type) {
+	case safehtml.HTML:
+		return "text/html; charset=utf-8", nil
+	case JSONResponse:
+		return "application/x-ndjson; charset=utf-8", nil
+	default:
+		return "", fmt.Errorf("%T is not a safe response type", resp)
+	}
+}
+
+// WriteFragment writes a safehtml.HTML fragment as is and a JSONResponse
+// fragment as a single line of JSON.
+func (DefaultDispatcher) WriteFragment(w io.Writer, resp Response, first bool) error {
+	switch x := resp.(type) {
+	case safehtml.HTML:
+		_, err := io.WriteString(w, x.String())
+		return err
+	case JSONResponse:
+		b, err := json.Marshal(x.Data)
+		if err != nil {
+			return err
+		}
+		if first {
+			if _, err := io.WriteString(w, jsonPrefix); err != nil {
+				return err
+			}
+		}
+		// encoding/json never produces raw newlines, the line can't be split.
+		_, err = w.Write(append(b, '\n'))
+		return err
+	default:
+		return fmt.Errorf("%T is not a safe response type", resp)
+	}
+}
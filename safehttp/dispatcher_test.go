@@ -0,0 +1,223 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	texttemplate "text/template"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+	"github.com/google/safehtml/template"
+)
+
+func TestDefaultDispatcherWrite(t *testing.T) {
+	b := &strings.Builder{}
+	rr := newResponseRecorder(b)
+
+	err := safehttp.DefaultDispatcher{}.Write(rr, safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+	if err != nil {
+		t.Fatalf("DefaultDispatcher{}.Write() got err: %v want: nil", err)
+	}
+
+	wantHeaders := map[string][]string{"Content-Type": {"text/html; charset=utf-8"}}
+	if diff := cmp.Diff(wantHeaders, map[string][]string(rr.header)); diff != "" {
+		t.Errorf("rr.header mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := b.String(), "&lt;h1&gt;Hello World!&lt;/h1&gt;"; got != want {
+		t.Errorf("response body got: %q want: %q", got, want)
+	}
+}
+
+func TestDefaultDispatcherWriteJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     interface{}
+		wantBody string
+	}{
+		{
+			name:     "Struct",
+			data:     struct{ Field string }{Field: "myField"},
+			wantBody: ")]}'\n{\"Field\":\"myField\"}",
+		},
+		{
+			name:     "Array",
+			data:     []int{1, 2, 3},
+			wantBody: ")]}'\n[1,2,3]",
+		},
+		{
+			name:     "HTML characters",
+			data:     "<script>alert(1)</script>",
+			wantBody: ")]}'\n\"\\u003cscript\\u003ealert(1)\\u003c/script\\u003e\"",
+		},
+		{
+			name:     "Valid json.Marshaler",
+			data:     jsonMarshaler(`{"a": 1}`),
+			wantBody: ")]}'\n{\"a\":1}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rr := newResponseRecorder(b)
+
+			if err := (safehttp.DefaultDispatcher{}).Write(rr, safehttp.JSONResponse{Data: tt.data}); err != nil {
+				t.Fatalf("DefaultDispatcher{}.Write() got err: %v want: nil", err)
+			}
+
+			wantHeaders := map[string][]string{"Content-Type": {"application/json; charset=utf-8"}}
+			if diff := cmp.Diff(wantHeaders, map[string][]string(rr.header)); diff != "" {
+				t.Errorf("rr.header mismatch (-want +got):\n%s", diff)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body got: %q want: %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+type jsonMarshaler string
+
+func (m jsonMarshaler) MarshalJSON() ([]byte, error) {
+	return []byte(m), nil
+}
+
+func TestDefaultDispatcherWriteInvalidJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data interface{}
+	}{
+		{
+			name: "JSONP callback",
+			data: jsonMarshaler(`callback({"a": 1})`),
+		},
+		{
+			name: "Trailing script",
+			data: jsonMarshaler(`{"a": 1}; alert(1)`),
+		},
+		{
+			name: "Unsupported type",
+			data: make(chan int),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rr := newResponseRecorder(b)
+
+			if err := (safehttp.DefaultDispatcher{}).Write(rr, safehttp.JSONResponse{Data: tt.data}); err == nil {
+				t.Error("DefaultDispatcher{}.Write() got: nil want: error")
+			}
+			if len(rr.header) != 0 {
+				t.Errorf("rr.header got: %v want: empty", rr.header)
+			}
+			if got := b.String(); got != "" {
+				t.Errorf("response body got: %q want: empty", got)
+			}
+		})
+	}
+}
+
+func TestDefaultDispatcherExecuteTemplate(t *testing.T) {
+	b := &strings.Builder{}
+	rr := newResponseRecorder(b)
+
+	tmpl := template.Must(template.New("name").Parse("<h1>{{ . }}</h1>"))
+	if err := (safehttp.DefaultDispatcher{}).ExecuteTemplate(rr, tmpl, "This is a <title>"); err != nil {
+		t.Fatalf("DefaultDispatcher{}.ExecuteTemplate() got err: %v want: nil", err)
+	}
+
+	wantHeaders := map[string][]string{"Content-Type": {"text/html; charset=utf-8"}}
+	if diff := cmp.Diff(wantHeaders, map[string][]string(rr.header)); diff != "" {
+		t.Errorf("rr.header mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := b.String(), "<h1>This is a &lt;title&gt;</h1>"; got != want {
+		t.Errorf("response body got: %q want: %q", got, want)
+	}
+}
+
+func TestDefaultDispatcherInvalidResponse(t *testing.T) {
+	b := &strings.Builder{}
+	rr := newResponseRecorder(b)
+
+	if err := (safehttp.DefaultDispatcher{}).Write(rr, "<h1>Hello World!</h1>"); err == nil {
+		t.Error("DefaultDispatcher{}.Write() got: nil want: error")
+	}
+	if len(rr.header) != 0 {
+		t.Errorf("rr.header got: %v want: empty", rr.header)
+	}
+	if got := b.String(); got != "" {
+		t.Errorf("response body got: %q want: empty", got)
+	}
+}
+
+func TestDefaultDispatcherInvalidTemplate(t *testing.T) {
+	tests := []struct {
+		name string
+		t    safehttp.Template
+	}{
+		{
+			name: "text/template",
+			t:    texttemplate.Must(texttemplate.New("name").Parse("<h1>{{ . }}</h1>")),
+		},
+		{
+			name: "Execution error",
+			t:    template.Must(template.New("name").Parse(`{{ template "missing" }}`)),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rr := newResponseRecorder(b)
+
+			if err := (safehttp.DefaultDispatcher{}).ExecuteTemplate(rr, tt.t, "data"); err == nil {
+				t.Error("DefaultDispatcher{}.ExecuteTemplate() got: nil want: error")
+			}
+			if len(rr.header) != 0 {
+				t.Errorf("rr.header got: %v want: empty", rr.header)
+			}
+			if got := b.String(); got != "" {
+				t.Errorf("response body got: %q want: empty", got)
+			}
+		})
+	}
+}
+
+func TestNewServeMuxDefaultDispatcher(t *testing.T) {
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+	}))
+
+	rw := httptest.NewRecorder()
+	mux.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "http://foo.com/", nil))
+
+	if got, want := rw.Code, http.StatusOK; got != want {
+		t.Errorf("rw.Code got: %v want: %v", got, want)
+	}
+	if got, want := rw.Header().Get("Content-Type"), "text/html; charset=utf-8"; got != want {
+		t.Errorf(`rw.Header().Get("Content-Type") got: %q want: %q`, got, want)
+	}
+	if got, want := rw.Body.String(), "&lt;h1&gt;Hello World!&lt;/h1&gt;"; got != want {
+		t.Errorf("rw.Body.String() got: %q want: %q", got, want)
+	}
+}
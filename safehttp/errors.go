@@ -0,0 +1,58 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ErrorHook is called by a ServeMux with the errors that occur while serving
+// a request and that can't be returned to the handler, e.g. Dispatcher
+// failures or recovered panics. It can be used to log or monitor them.
+//
+// The ErrorHook is called before the error response is written, and must not
+// write to the response itself.
+type ErrorHook func(r *IncomingRequest, err error)
+
+// PanicError is the error reported to the ErrorHook when a panic is recovered
+// while serving a request.
+type PanicError struct {
+	// Value is the value the panic was called with.
+	Value interface{}
+	// Stack is the stack trace of the goroutine that panicked, as returned by
+	// runtime/debug.Stack.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.Value, e.Stack)
+}
+
+// RequestError is an error caused by an invalid request. Code is the status
+// code the request should be answered with, e.g. using
+// ResponseWriter.WriteError.
+type RequestError struct {
+	Code StatusCode
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("%d %s: %v", e.Code, http.StatusText(int(e.Code)), e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Event is a server-sent event.
+type Event struct {
+	// ID is the optional ID of the event. It can't contain newlines or NUL
+	// characters.
+	ID string
+	// Event is the optional type of the event. It can't contain newlines.
+	Event string
+	// Data is the payload of the event. It can contain newlines, each line is
+	// sent in its own data field.
+	Data string
+}
+
+// EventStream is a stream of server-sent events, as specified in
+// https://html.spec.whatwg.org/multipage/server-sent-events.html. It is
+// created by ResponseWriter.EventStream.
+type EventStream struct {
+	w   *ResponseWriter
+	ctx context.Context
+	err error
+}
+
+// errEventStreamClosed is returned when sending to a closed EventStream.
+var errEventStreamClosed = errors.New("send on closed event stream")
+
+// EventStream starts a stream of server-sent events in response to the
+// IncomingRequest. The response is committed immediately with a Content-Type
+// of "text/event-stream" and a "Cache-Control: no-cache" header.
+//
+// The EventStream is closed when the context of the IncomingRequest is
+// cancelled, e.g. because the client went away. Handlers should send events
+// until then, which can be awaited through Done, and close the EventStream.
+func (w *ResponseWriter) EventStream(r *IncomingRequest) *EventStream {
+	w.markWritten()
+	w.status = StatusOK
+	h := w.rw.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.commit()
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return &EventStream{w: w, ctx: r.Context()}
+}
+
+// Done returns a channel that is closed when the EventStream is closed because
+// the context of the request was cancelled.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// Send sends the event to the client and flushes it. Each line of the data of
+// the event is sent in its own data field, so that the data can't inject
+// additional fields or events. Send returns an error without sending anything
+// if the ID or the type of the event contain a newline.
+//
+// Send returns an error if the EventStream is closed. Once Send has failed to
+// write to the client, all subsequent calls fail as well.
+func (s *EventStream) Send(e Event) error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.err = err
+		return err
+	}
+	if strings.ContainsAny(e.ID, "\r\n\x00") {
+		return fmt.Errorf("invalid event ID %q", e.ID)
+	}
+	if strings.ContainsAny(e.Event, "\r\n") {
+		return fmt.Errorf("invalid event type %q", e.Event)
+	}
+
+	var b strings.Builder
+	if e.ID != "" {
+		b.WriteString("id: " + e.ID + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + e.Event + "\n")
+	}
+	data := strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(e.Data)
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	if _, err := s.w.rw.Write([]byte(b.String())); err != nil {
+		s.err = err
+		return err
+	}
+	if f, ok := s.w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close closes the EventStream. Subsequent calls to Send return an error.
+func (s *EventStream) Close() Result {
+	if s.err == nil {
+		s.err = errEventStreamClosed
+	}
+	return Result{}
+}
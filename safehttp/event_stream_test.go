@@ -0,0 +1,161 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestEventStreamSend(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    safehttp.Event
+		wantBody string
+	}{
+		{
+			name:     "Data",
+			event:    safehttp.Event{Data: "hello"},
+			wantBody: "data: hello\n\n",
+		},
+		{
+			name:     "All fields",
+			event:    safehttp.Event{ID: "42", Event: "update", Data: "hello"},
+			wantBody: "id: 42\nevent: update\ndata: hello\n\n",
+		},
+		{
+			name:     "Empty data",
+			event:    safehttp.Event{Event: "ping"},
+			wantBody: "event: ping\ndata: \n\n",
+		},
+		{
+			name:     "Multiline data",
+			event:    safehttp.Event{Data: "first\nsecond\r\nthird\rfourth"},
+			wantBody: "data: first\ndata: second\ndata: third\ndata: fourth\n\n",
+		},
+		{
+			name:     "Injected event",
+			event:    safehttp.Event{Data: "hello\n\nevent: logout\ndata: now"},
+			wantBody: "data: hello\ndata: \ndata: event: logout\ndata: data: now\n\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+			r := safehttptest.NewRequest(safehttp.MethodGet, "/events", nil)
+
+			s := w.EventStream(r)
+			if err := s.Send(tt.event); err != nil {
+				t.Fatalf("s.Send(%+v) got err: %v want: nil", tt.event, err)
+			}
+			s.Close()
+
+			if got, want := rec.Code, http.StatusOK; got != want {
+				t.Errorf("rec.Code got: %v want: %v", got, want)
+			}
+			wantHeaders := map[string][]string{
+				"Content-Type":  {"text/event-stream"},
+				"Cache-Control": {"no-cache"},
+			}
+			if diff := cmp.Diff(wantHeaders, map[string][]string(rec.Header())); diff != "" {
+				t.Errorf("rec.Header() mismatch (-want +got):\n%s", diff)
+			}
+			if !rec.Flushed {
+				t.Error("rec.Flushed got: false want: true")
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("rec.Body.String() got: %q want: %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestEventStreamSendInvalidEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event safehttp.Event
+	}{
+		{name: "Newline in ID", event: safehttp.Event{ID: "1\ndata: injected"}},
+		{name: "Carriage return in ID", event: safehttp.Event{ID: "1\rdata: injected"}},
+		{name: "NUL in ID", event: safehttp.Event{ID: "1\x00"}},
+		{name: "Newline in event", event: safehttp.Event{Event: "update\n\nevent: logout"}},
+		{name: "Carriage return in event", event: safehttp.Event{Event: "update\revent: logout"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+			r := safehttptest.NewRequest(safehttp.MethodGet, "/events", nil)
+
+			s := w.EventStream(r)
+			if err := s.Send(tt.event); err == nil {
+				t.Errorf("s.Send(%+v) got: nil want: error", tt.event)
+			}
+			if err := s.Send(safehttp.Event{Data: "valid"}); err != nil {
+				t.Errorf("s.Send() after an invalid event got err: %v want: nil", err)
+			}
+
+			if got, want := rec.Body.String(), "data: valid\n\n"; got != want {
+				t.Errorf("rec.Body.String() got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestEventStreamContextCancelled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+	r := safehttptest.NewRequest(safehttp.MethodGet, "/events", nil)
+	ctx, cancel := context.WithCancel(r.Context())
+	r.SetContext(ctx)
+
+	s := w.EventStream(r)
+	if err := s.Send(safehttp.Event{Data: "first"}); err != nil {
+		t.Fatalf("s.Send() got err: %v want: nil", err)
+	}
+	cancel()
+	<-s.Done()
+	if err := s.Send(safehttp.Event{Data: "second"}); err != context.Canceled {
+		t.Errorf("s.Send() after cancellation got err: %v want: %v", err, context.Canceled)
+	}
+
+	if got, want := rec.Body.String(), "data: first\n\n"; got != want {
+		t.Errorf("rec.Body.String() got: %q want: %q", got, want)
+	}
+}
+
+func TestEventStreamClosed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+	r := safehttptest.NewRequest(safehttp.MethodGet, "/events", nil)
+
+	s := w.EventStream(r)
+	s.Close()
+	if err := s.Send(safehttp.Event{Data: "data"}); err == nil {
+		t.Error("s.Send() after s.Close() got: nil want: error")
+	}
+	if got := rec.Body.String(); got != "" {
+		t.Errorf("rec.Body.String() got: %q want: empty", got)
+	}
+}
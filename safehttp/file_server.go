@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// defaultContentTypes is the allowlist of file extensions used by a
+// FileServer without ContentTypes.
+var defaultContentTypes = map[string]string{
+	".css":   "text/css; charset=utf-8",
+	".gif":   "image/gif",
+	".html":  "text/html; charset=utf-8",
+	".ico":   "image/x-icon",
+	".jpeg":  "image/jpeg",
+	".jpg":   "image/jpeg",
+	".js":    "text/javascript; charset=utf-8",
+	".json":  "application/json; charset=utf-8",
+	".pdf":   "application/pdf",
+	".png":   "image/png",
+	".svg":   "image/svg+xml",
+	".txt":   "text/plain; charset=utf-8",
+	".wasm":  "application/wasm",
+	".webp":  "image/webp",
+	".woff":  "font/woff",
+	".woff2": "font/woff2",
+}
+
+// FileServer is a Handler serving the files of a file system. Directories
+// are never listed, and requests for directories, for files or directories
+// whose name starts with a dot, and for paths containing . or .. elements are
+// answered with 404 Not Found.
+//
+// Files are only served if their extension is in the ContentTypes allowlist,
+// and always with the corresponding Content-Type instead of a sniffed one.
+// Conditional requests and range requests are supported, based on an ETag
+// computed from the modification time and the size of the file, or from its
+// content if the file system doesn't provide modification times.
+type FileServer struct {
+	// FS is the file system the files are served from. Use os.DirFS to serve
+	// the files of a directory.
+	FS fs.FS
+	// Prefix is removed from the path of the request in order to get the name
+	// of the file, e.g. "/static/" when the FileServer is registered for the
+	// "/static/" pattern. If Prefix doesn't end with a slash, it must be
+	// followed by one, e.g. "/static" matches "/static/foo.txt" but not
+	// "/staticfoo.txt". Requests whose path doesn't start with Prefix are
+	// answered with 404 Not Found.
+	Prefix string
+	// ContentTypes maps file extensions, including the leading dot, to the
+	// Content-Type the files are served with. Files with other extensions
+	// aren't served. If nil, an allowlist of common web file types is used.
+	ContentTypes map[string]string
+	// Untrusted must be set if the files can be controlled by users, e.g.
+	// uploads. They are then served as attachments, with a
+	// "Content-Disposition: attachment" header, and in a sandbox, with a
+	// "Content-Security-Policy: sandbox" header, so that they can't run
+	// scripts in the origin of the application even if they are rendered.
+	Untrusted bool
+}
+
+// ServeHTTP serves the file named by the path of the request.
+func (s FileServer) ServeHTTP(w *ResponseWriter, r *IncomingRequest) Result {
+	name, ok := s.fileName(r.URL.Path())
+	if !ok {
+		return w.WriteError(StatusNotFound)
+	}
+	types := s.ContentTypes
+	if types == nil {
+		types = defaultContentTypes
+	}
+	ct, ok := types[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return w.WriteError(StatusNotFound)
+	}
+
+	f, err := s.FS.Open(name)
+	if err != nil {
+		return w.WriteError(StatusNotFound)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return w.WriteError(StatusNotFound)
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok || fi.ModTime().IsZero() {
+		// The content is needed to compute the ETag or to support ranges.
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return w.WriteError(StatusInternalServerError)
+		}
+		content = bytes.NewReader(b)
+	}
+	etag, err := fileETag(fi, content)
+	if err != nil {
+		return w.WriteError(StatusInternalServerError)
+	}
+
+	w.markWritten()
+	w.status = StatusOK
+	h := w.rw.Header()
+	h.Set("Content-Type", ct)
+	h.Set("ETag", etag)
+	if s.Untrusted {
+		h.Set("Content-Disposition", "attachment")
+		// Adding a policy can only make the policies already set stricter.
+		h.Add("Content-Security-Policy", "sandbox")
+		h.Set("X-Content-Type-Options", "nosniff")
+	}
+	http.ServeContent(fileResponseWriter{w}, r.req, name, fi.ModTime(), content)
+	w.commit()
+	return Result{}
+}
+
+// fileName returns the name of the file in FS corresponding to the path of a
+// request.
+func (s FileServer) fileName(p string) (string, bool) {
+	prefix := s.Prefix
+	if !strings.HasSuffix(prefix, "/") {
+		// The prefix must end at a path segment boundary, e.g. "/static"
+		// matches "/static/foo.txt" but not "/staticfoo.txt".
+		prefix += "/"
+	}
+	if !strings.HasPrefix(p, prefix) {
+		return "", false
+	}
+	name := p[len(prefix):]
+	if !fs.ValidPath(name) || name == "." || strings.ContainsAny(name, "\\\x00") {
+		return "", false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if strings.HasPrefix(elem, ".") {
+			return "", false
+		}
+	}
+	return name, true
+}
+
+// fileETag returns a strong ETag for the file, computed from its modification
+// time and size if available and from its content otherwise.
+func fileETag(fi fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if !fi.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()), nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%x"`, hash.Sum(nil)[:16]), nil
+}
+
+// fileResponseWriter is the http.ResponseWriter passed to http.ServeContent.
+// Unlike responseCommitter, it honors the status code chosen by
+// http.ServeContent, e.g. 206 Partial Content or 304 Not Modified.
+type fileResponseWriter struct {
+	w *ResponseWriter
+}
+
+func (f fileResponseWriter) Header() http.Header {
+	return f.w.rw.Header()
+}
+
+func (f fileResponseWriter) WriteHeader(code int) {
+	if !f.w.committed {
+		f.w.status = StatusCode(code)
+	}
+	f.w.commit()
+}
+
+func (f fileResponseWriter) Write(b []byte) (int, error) {
+	f.w.commit()
+	return f.w.rw.Write(b)
+}
@@ -0,0 +1,284 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var testFS = fstest.MapFS{
+	"index.html":          {Data: []byte("<h1>Hello</h1>"), ModTime: time.Unix(1600000000, 0)},
+	"css/style.css":       {Data: []byte("body {}"), ModTime: time.Unix(1600000000, 0)},
+	"js/app.js":           {Data: []byte("alert(1)"), ModTime: time.Unix(1600000000, 0)},
+	"embedded.txt":        {Data: []byte("no modification time")},
+	"secret.key":          {Data: []byte("secret")},
+	".env":                {Data: []byte("SECRET=1")},
+	".git/config.txt":     {Data: []byte("secret")},
+	"uploads/image.png":   {Data: []byte("\x89PNG"), ModTime: time.Unix(1600000000, 0)},
+	"uploads/comment.txt": {Data: []byte("<script>alert(1)</script>"), ModTime: time.Unix(1600000000, 0)},
+	"uploads/page.html":   {Data: []byte("<script>alert(1)</script>"), ModTime: time.Unix(1600000000, 0)},
+}
+
+func serveFile(fsrv safehttp.FileServer, pattern string, req *http.Request) *httptest.ResponseRecorder {
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Handle(pattern, safehttp.MethodGet, fsrv)
+	mux.Handle(pattern, safehttp.MethodHead, fsrv)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestFileServer(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "HTML",
+			path:            "/static/index.html",
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "<h1>Hello</h1>",
+		},
+		{
+			name:            "CSS in a subdirectory",
+			path:            "/static/css/style.css",
+			wantContentType: "text/css; charset=utf-8",
+			wantBody:        "body {}",
+		},
+		{
+			name:            "JavaScript",
+			path:            "/static/js/app.js",
+			wantContentType: "text/javascript; charset=utf-8",
+			wantBody:        "alert(1)",
+		},
+		{
+			name:            "No modification time",
+			path:            "/static/embedded.txt",
+			wantContentType: "text/plain; charset=utf-8",
+			wantBody:        "no modification time",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsrv := safehttp.FileServer{FS: testFS, Prefix: "/static/"}
+			rec := serveFile(fsrv, "/static/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+tt.path, nil))
+
+			if got, want := rec.Code, http.StatusOK; got != want {
+				t.Errorf("rec.Code got: %v want: %v", got, want)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf(`rec.Header().Get("Content-Type") got: %q want: %q`, got, tt.wantContentType)
+			}
+			if got := rec.Header().Get("ETag"); got == "" {
+				t.Error(`rec.Header().Get("ETag") got: "" want: ETag`)
+			}
+			if got := rec.Header().Get("Content-Disposition"); got != "" {
+				t.Errorf(`rec.Header().Get("Content-Disposition") got: %q want: ""`, got)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("rec.Body.String() got: %q want: %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestFileServerNotFound(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "Missing file", path: "/static/missing.html"},
+		{name: "Root directory", path: "/static/"},
+		{name: "Directory", path: "/static/css"},
+		{name: "Directory with slash", path: "/static/css/"},
+		{name: "Dotfile", path: "/static/.env"},
+		{name: "Dot directory", path: "/static/.git/config.txt"},
+		{name: "Extension not allowed", path: "/static/secret.key"},
+		{name: "Encoded traversal", path: "/static/css/%2e%2e/secret.key"},
+		{name: "Backslash", path: "/static/css%5cstyle.css"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsrv := safehttp.FileServer{FS: testFS, Prefix: "/static/"}
+			rec := serveFile(fsrv, "/static/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+tt.path, nil))
+
+			// Paths with . or .. elements are redirected by the ServeMux
+			// before reaching the FileServer.
+			if rec.Code != http.StatusNotFound && rec.Code != http.StatusMovedPermanently {
+				t.Errorf("rec.Code got: %v want: %v", rec.Code, http.StatusNotFound)
+			}
+			if got := rec.Body.String(); got == "secret" || got == "SECRET=1" {
+				t.Errorf("rec.Body.String() got: %q want: no file content", got)
+			}
+		})
+	}
+}
+
+func TestFileServerPrefixWithoutSlash(t *testing.T) {
+	fsrv := safehttp.FileServer{FS: testFS, Prefix: "/static"}
+
+	tests := []struct {
+		path     string
+		wantCode int
+	}{
+		{path: "/static/index.html", wantCode: http.StatusOK},
+		{path: "/staticindex.html", wantCode: http.StatusNotFound},
+		{path: "/static", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := serveFile(fsrv, "/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+tt.path, nil))
+			if rec.Code != tt.wantCode {
+				t.Errorf("rec.Code got: %v want: %v", rec.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestFileServerContentTypes(t *testing.T) {
+	fsrv := safehttp.FileServer{
+		FS:           testFS,
+		ContentTypes: map[string]string{".key": "application/octet-stream"},
+	}
+
+	rec := serveFile(fsrv, "/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com/secret.key", nil))
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Errorf("rec.Code got: %v want: %v", got, want)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "application/octet-stream"; got != want {
+		t.Errorf(`rec.Header().Get("Content-Type") got: %q want: %q`, got, want)
+	}
+
+	rec = serveFile(fsrv, "/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com/index.html", nil))
+	if got, want := rec.Code, http.StatusNotFound; got != want {
+		t.Errorf("rec.Code got: %v want: %v", got, want)
+	}
+}
+
+func TestFileServerUntrusted(t *testing.T) {
+	fsrv := safehttp.FileServer{FS: testFS, Prefix: "/uploads/", Untrusted: true}
+	for _, p := range []string{"/uploads/uploads/page.html", "/uploads/uploads/comment.txt", "/uploads/uploads/image.png"} {
+		t.Run(p, func(t *testing.T) {
+			rec := serveFile(fsrv, "/uploads/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+p, nil))
+
+			if got, want := rec.Code, http.StatusOK; got != want {
+				t.Errorf("rec.Code got: %v want: %v", got, want)
+			}
+			if got, want := rec.Header().Get("Content-Disposition"), "attachment"; got != want {
+				t.Errorf(`rec.Header().Get("Content-Disposition") got: %q want: %q`, got, want)
+			}
+			if got, want := rec.Header().Get("Content-Security-Policy"), "sandbox"; got != want {
+				t.Errorf(`rec.Header().Get("Content-Security-Policy") got: %q want: %q`, got, want)
+			}
+			if got, want := rec.Header().Get("X-Content-Type-Options"), "nosniff"; got != want {
+				t.Errorf(`rec.Header().Get("X-Content-Type-Options") got: %q want: %q`, got, want)
+			}
+		})
+	}
+}
+
+func TestFileServerConditionalRequests(t *testing.T) {
+	fsrv := safehttp.FileServer{FS: testFS}
+
+	for _, p := range []string{"/index.html", "/embedded.txt"} {
+		t.Run(p, func(t *testing.T) {
+			rec := serveFile(fsrv, "/", httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+p, nil))
+			etag := rec.Header().Get("ETag")
+			if etag == "" {
+				t.Fatal(`rec.Header().Get("ETag") got: "" want: ETag`)
+			}
+
+			req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+p, nil)
+			req.Header.Set("If-None-Match", etag)
+			rec = serveFile(fsrv, "/", req)
+			if got, want := rec.Code, http.StatusNotModified; got != want {
+				t.Errorf("rec.Code got: %v want: %v", got, want)
+			}
+			if got := rec.Body.String(); got != "" {
+				t.Errorf("rec.Body.String() got: %q want: empty", got)
+			}
+
+			req = httptest.NewRequest(safehttp.MethodGet, "http://foo.com"+p, nil)
+			req.Header.Set("If-None-Match", `"other"`)
+			rec = serveFile(fsrv, "/", req)
+			if got, want := rec.Code, http.StatusOK; got != want {
+				t.Errorf("rec.Code got: %v want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestFileServerRange(t *testing.T) {
+	fsrv := safehttp.FileServer{FS: testFS}
+	req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/index.html", nil)
+	req.Header.Set("Range", "bytes=4-8")
+
+	rec := serveFile(fsrv, "/", req)
+
+	if got, want := rec.Code, http.StatusPartialContent; got != want {
+		t.Errorf("rec.Code got: %v want: %v", got, want)
+	}
+	if got, want := rec.Header().Get("Content-Range"), "bytes 4-8/14"; got != want {
+		t.Errorf(`rec.Header().Get("Content-Range") got: %q want: %q`, got, want)
+	}
+	if got, want := rec.Body.String(), "Hello"; got != want {
+		t.Errorf("rec.Body.String() got: %q want: %q", got, want)
+	}
+}
+
+func TestFileServerInterceptors(t *testing.T) {
+	var stages []string
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(stagesInterceptor{name: "one", stages: &stages})
+	mux.Handle("/", safehttp.MethodGet, safehttp.FileServer{FS: testFS})
+
+	req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/index.html", nil)
+	req.Header.Set("Range", "bytes=4-8")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if got, want := rec.Header().Get("Committed-By"), "one"; got != want {
+		t.Errorf(`rec.Header().Get("Committed-By") got: %q want: %q`, got, want)
+	}
+	if got, want := stages[len(stages)-1], "one After 206"; got != want {
+		t.Errorf("last stage got: %q want: %q", got, want)
+	}
+}
+
+func TestFileServerTraversalWithoutServeMux(t *testing.T) {
+	fsrv := safehttp.FileServer{FS: testFS, Prefix: "/static/", ContentTypes: map[string]string{".key": "text/plain"}}
+	for _, p := range []string{"/static/../secret.key", "/static/css/../../secret.key", "/static/./secret.key", "/static//secret.key"} {
+		t.Run(p, func(t *testing.T) {
+			rec := safehttptest.NewResponseRecorder()
+			fsrv.ServeHTTP(rec.ResponseWriter, safehttptest.NewRequest(safehttp.MethodGet, "http://foo.com"+p, nil))
+
+			if got, want := rec.Status(), safehttp.StatusNotFound; got != want {
+				t.Errorf("rec.Status() got: %v want: %v", got, want)
+			}
+		})
+	}
+}
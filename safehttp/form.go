@@ -216,7 +216,9 @@ func (f *MultipartForm) File(param string) []*multipart.FileHeader {
 }
 
 // RemoveFiles removes any temporary files associated with a Form and returns
-// the first error that occured, if any.
+// the first error that occured, if any. When the request is served by a
+// ServeMux, the files are removed automatically once the request has been
+// served.
 func (f *MultipartForm) RemoveFiles() error {
 	return f.mf.RemoveAll()
 }
@@ -0,0 +1,277 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingParam is the error of a FieldError reported for a required
+// parameter that is missing or empty.
+var ErrMissingParam = errors.New("missing required parameter")
+
+// ErrRepeatedParam is the error of a FieldError reported for a parameter with
+// multiple values bound to a field which isn't a slice.
+var ErrRepeatedParam = errors.New("repeated parameter")
+
+// FieldError is an error that occurred while binding a form parameter to a
+// struct field.
+type FieldError struct {
+	// Field is the name of the form parameter.
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors is a list of FieldError, one per form parameter that failed.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fe.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// Bind decodes the form parameters into the struct pointed to by dst.
+//
+// Each exported field is bound to the form parameter named by its "form" tag,
+// or by the name of the field if it has no such tag. Fields tagged with
+// `form:"-"` are skipped. Options can follow the name in the tag, separated by
+// commas:
+//   - required: the parameter must be present and non-empty.
+//
+// The "default" tag sets the value of a field whose parameter is missing, e.g.
+// `form:"page" default:"1"`.
+//
+// The following field types are supported: strings, booleans, integers,
+// floating-point numbers, time.Duration (as parsed by time.ParseDuration),
+// time.Time (in RFC 3339 format, unless a "layout" tag gives another layout),
+// types implementing encoding.TextUnmarshaler and pointers to any of these.
+// Slices of these types receive all the values of their parameter, while other
+// fields require the parameter to have a single value. Fields of struct types
+// are bound recursively, with their fields named
+// "<field name>.<nested field name>".
+//
+// Bind returns a FieldErrors listing all the parameters that couldn't be
+// bound, or nil if all of them were. Fields whose parameter is invalid are
+// left unchanged. Bind returns another error if dst is not a non-nil pointer to
+// a struct or if it contains unsupported field types.
+func (f *Form) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("destination must be a non-nil pointer to a struct, got %T", dst)
+	}
+	var errs FieldErrors
+	if err := f.bindStruct(v.Elem(), "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (f *Form) bindStruct(v reflect.Value, prefix string, errs *FieldErrors) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported field.
+			continue
+		}
+		tag := sf.Tag.Get("form")
+		if tag == "-" {
+			continue
+		}
+		opts := strings.Split(tag, ",")
+		name := opts[0]
+		if name == "" {
+			name = sf.Name
+		}
+		name = prefix + name
+
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && !isBindable(sf.Type) {
+			if err := f.bindStruct(fv, name+".", errs); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isBindable(sf.Type) && !(sf.Type.Kind() == reflect.Slice && isBindable(sf.Type.Elem())) {
+			return fmt.Errorf("unsupported type %v for field %s", sf.Type, sf.Name)
+		}
+
+		required := false
+		for _, o := range opts[1:] {
+			switch o {
+			case "required":
+				required = true
+			default:
+				return fmt.Errorf("unknown option %q for field %s", o, sf.Name)
+			}
+		}
+
+		vals := f.values[name]
+		if required && (len(vals) == 0 || vals[0] == "") {
+			*errs = append(*errs, &FieldError{Field: name, Err: ErrMissingParam})
+			continue
+		}
+		if len(vals) == 0 {
+			def, ok := sf.Tag.Lookup("default")
+			if !ok {
+				continue
+			}
+			vals = []string{def}
+		}
+
+		layout := sf.Tag.Get("layout")
+		if err := setField(fv, vals, layout); err != nil {
+			*errs = append(*errs, &FieldError{Field: name, Err: err})
+		}
+	}
+	return nil
+}
+
+// isBindable reports whether a single parameter value can be bound to a value
+// of type t.
+func isBindable(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) || t == timeType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Ptr:
+		return t.Elem().Kind() != reflect.Ptr && isBindable(t.Elem())
+	}
+	return false
+}
+
+// setField sets the field to the parsed values. The field is only modified if
+// all the values are valid.
+func setField(fv reflect.Value, vals []string, layout string) error {
+	t := fv.Type()
+	if t.Kind() != reflect.Slice || isBindable(t) {
+		if len(vals) > 1 {
+			return ErrRepeatedParam
+		}
+		nv := reflect.New(t).Elem()
+		if err := setValue(nv, vals[0], layout); err != nil {
+			return err
+		}
+		fv.Set(nv)
+		return nil
+	}
+
+	s := reflect.MakeSlice(t, len(vals), len(vals))
+	for i, val := range vals {
+		if err := setValue(s.Index(i), val, layout); err != nil {
+			return err
+		}
+	}
+	fv.Set(s)
+	return nil
+}
+
+func setValue(v reflect.Value, val string, layout string) error {
+	if v.Kind() == reflect.Ptr {
+		nv := reflect.New(v.Type().Elem())
+		if err := setValue(nv.Elem(), val, layout); err != nil {
+			return err
+		}
+		v.Set(nv)
+		return nil
+	}
+	switch v.Type() {
+	case timeType:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		t, err := time.Parse(layout, val)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case durationType:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(val))
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(val, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
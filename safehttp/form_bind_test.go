@@ -0,0 +1,287 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type color struct {
+	r, g, b uint8
+}
+
+func (c *color) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "#%02x%02x%02x", &c.r, &c.g, &c.b)
+	return err
+}
+
+type address struct {
+	Street string   `form:"street"`
+	Tags   []string `form:"tags"`
+}
+
+type bindTarget struct {
+	Name     string        `form:"name,required"`
+	Age      int           `form:"age"`
+	Admin    bool          `form:"admin"`
+	Score    float64       `form:"score"`
+	Count    uint8         `form:"count"`
+	Page     int64         `form:"page" default:"1"`
+	IDs      []int64       `form:"id"`
+	Start    time.Time     `form:"start"`
+	Day      time.Time     `form:"day" layout:"2006-01-02"`
+	Timeout  time.Duration `form:"timeout"`
+	Color    color         `form:"color"`
+	Colors   []color       `form:"colors"`
+	Nickname *string       `form:"nickname"`
+	Limit    *int          `form:"limit"`
+	Address  address       `form:"address"`
+	Untagged string
+	Skipped  string `form:"-"`
+	private  string
+}
+
+func TestFormBind(t *testing.T) {
+	values := map[string][]string{
+		"name":           {"Alice"},
+		"age":            {"42"},
+		"admin":          {"true"},
+		"score":          {"1.5"},
+		"count":          {"7"},
+		"id":             {"1", "2", "3"},
+		"start":          {"2020-08-01T10:00:00Z"},
+		"day":            {"2020-08-02"},
+		"timeout":        {"1m30s"},
+		"color":          {"#ff0080"},
+		"colors":         {"#000000", "#ffffff"},
+		"nickname":       {"al"},
+		"address.street": {"Main Street"},
+		"address.tags":   {"home", "work"},
+		"Untagged":       {"untagged"},
+		"Skipped":        {"skipped"},
+		"private":        {"private"},
+	}
+	f := Form{values: values}
+
+	var got bindTarget
+	if err := f.Bind(&got); err != nil {
+		t.Fatalf("f.Bind(&got) got err: %v want: nil", err)
+	}
+
+	nickname := "al"
+	want := bindTarget{
+		Name:     "Alice",
+		Age:      42,
+		Admin:    true,
+		Score:    1.5,
+		Count:    7,
+		Page:     1,
+		IDs:      []int64{1, 2, 3},
+		Start:    time.Date(2020, 8, 1, 10, 0, 0, 0, time.UTC),
+		Day:      time.Date(2020, 8, 2, 0, 0, 0, 0, time.UTC),
+		Timeout:  90 * time.Second,
+		Color:    color{0xff, 0x00, 0x80},
+		Colors:   []color{{0, 0, 0}, {0xff, 0xff, 0xff}},
+		Nickname: &nickname,
+		Address:  address{Street: "Main Street", Tags: []string{"home", "work"}},
+		Untagged: "untagged",
+	}
+	if diff := cmp.Diff(want, got, cmp.AllowUnexported(bindTarget{}, color{})); diff != "" {
+		t.Errorf("f.Bind(&got) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFormBindFieldErrors(t *testing.T) {
+	values := map[string][]string{
+		"name":    {""},
+		"age":     {"forty-two"},
+		"count":   {"300"},
+		"id":      {"1", "two"},
+		"start":   {"yesterday"},
+		"timeout": {"1 minute"},
+		"color":   {"red"},
+		"limit":   {"none"},
+		"admin":   {"true"},
+	}
+	f := Form{values: values}
+
+	got := bindTarget{Age: 1, IDs: []int64{9}}
+	err := f.Bind(&got)
+
+	var fes FieldErrors
+	if !errors.As(err, &fes) {
+		t.Fatalf("f.Bind(&got) got err: %v want: FieldErrors", err)
+	}
+	var gotFields []string
+	for _, fe := range fes {
+		gotFields = append(gotFields, fe.Field)
+	}
+	wantFields := []string{"name", "age", "count", "id", "start", "timeout", "color", "limit"}
+	if diff := cmp.Diff(wantFields, gotFields); diff != "" {
+		t.Errorf("FieldErrors fields mismatch (-want +got):\n%s", diff)
+	}
+	if !errors.Is(fes[0], ErrMissingParam) {
+		t.Errorf("errors.Is(fes[0], ErrMissingParam) got: false want: true, fes[0]: %v", fes[0])
+	}
+
+	// Invalid fields are left unchanged, valid ones are set.
+	if got.Age != 1 {
+		t.Errorf("got.Age got: %v want: 1", got.Age)
+	}
+	if diff := cmp.Diff([]int64{9}, got.IDs); diff != "" {
+		t.Errorf("got.IDs mismatch (-want +got):\n%s", diff)
+	}
+	if !got.Admin {
+		t.Error("got.Admin got: false want: true")
+	}
+}
+
+func TestFormBindMissingRequired(t *testing.T) {
+	f := Form{values: map[string][]string{}}
+
+	var got bindTarget
+	err := f.Bind(&got)
+
+	var fes FieldErrors
+	if !errors.As(err, &fes) {
+		t.Fatalf("f.Bind(&got) got err: %v want: FieldErrors", err)
+	}
+	if len(fes) != 1 || fes[0].Field != "name" || !errors.Is(fes[0].Err, ErrMissingParam) {
+		t.Errorf("f.Bind(&got) got: %v want: a single missing name error", fes)
+	}
+	if got.Page != 1 {
+		t.Errorf("got.Page got: %v want: 1", got.Page)
+	}
+}
+
+func TestFormBindInvalidTarget(t *testing.T) {
+	type unsupported struct {
+		M map[string]string `form:"m"`
+	}
+	type unknownOption struct {
+		A string `form:"a,optional"`
+	}
+	var (
+		s  struct{}
+		nl *struct{}
+	)
+	tests := []struct {
+		name string
+		dst  interface{}
+	}{
+		{name: "Not a pointer", dst: s},
+		{name: "Nil pointer", dst: nl},
+		{name: "Pointer to non-struct", dst: new(string)},
+		{name: "Unsupported field type", dst: &unsupported{}},
+		{name: "Unknown option", dst: &unknownOption{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Form{values: map[string][]string{"m": {"a"}, "a": {"a"}}}
+			err := f.Bind(tt.dst)
+			if err == nil {
+				t.Fatalf("f.Bind(%T) got: nil want: error", tt.dst)
+			}
+			var fes FieldErrors
+			if errors.As(err, &fes) {
+				t.Errorf("f.Bind(%T) got: %v want: non-FieldErrors error", tt.dst, err)
+			}
+		})
+	}
+}
+
+func TestQueryBind(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://foo.com/search?q=pizza&page=3&tag=a&tag=b", nil)
+	ir := NewIncomingRequest(req)
+	q, err := ir.URL.Query()
+	if err != nil {
+		t.Fatalf("ir.URL.Query() got err: %v want: nil", err)
+	}
+
+	var got struct {
+		Query string   `form:"q,required"`
+		Page  int      `form:"page" default:"1"`
+		Tags  []string `form:"tag"`
+	}
+	if err := q.Bind(&got); err != nil {
+		t.Fatalf("q.Bind(&got) got err: %v want: nil", err)
+	}
+	if got.Query != "pizza" || got.Page != 3 || strings.Join(got.Tags, ",") != "a,b" {
+		t.Errorf("q.Bind(&got) got: %+v want: {Query:pizza Page:3 Tags:[a b]}", got)
+	}
+}
+
+func TestMultipartFormBind(t *testing.T) {
+	body := "--123\r\n" +
+		"Content-Disposition: form-data; name=\"name\"\r\n" +
+		"\r\n" +
+		"Alice\r\n" +
+		"--123\r\n" +
+		"Content-Disposition: form-data; name=\"age\"\r\n" +
+		"\r\n" +
+		"42\r\n" +
+		"--123--\r\n"
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", `multipart/form-data; boundary="123"`)
+	ir := NewIncomingRequest(req)
+	mf, err := ir.MultipartForm(1024)
+	if err != nil {
+		t.Fatalf("ir.MultipartForm() got err: %v want: nil", err)
+	}
+
+	var got struct {
+		Name string `form:"name,required"`
+		Age  int    `form:"age"`
+	}
+	if err := mf.Bind(&got); err != nil {
+		t.Fatalf("mf.Bind(&got) got err: %v want: nil", err)
+	}
+	if got.Name != "Alice" || got.Age != 42 {
+		t.Errorf("mf.Bind(&got) got: %+v want: {Name:Alice Age:42}", got)
+	}
+}
+
+func TestFormBindRepeatedParam(t *testing.T) {
+	f := Form{values: map[string][]string{
+		"name": {"alice", "mallory"},
+		"id":   {"1", "2"},
+	}}
+
+	var got bindTarget
+	err := f.Bind(&got)
+
+	var fes FieldErrors
+	if !errors.As(err, &fes) {
+		t.Fatalf("f.Bind(&got) got err: %v want: FieldErrors", err)
+	}
+	if len(fes) != 1 || fes[0].Field != "name" || !errors.Is(fes[0].Err, ErrRepeatedParam) {
+		t.Errorf("f.Bind(&got) got: %v want: a single repeated name error", fes)
+	}
+	if got.Name != "" {
+		t.Errorf("got.Name got: %q want: %q", got.Name, "")
+	}
+	if diff := cmp.Diff([]int64{1, 2}, got.IDs); diff != "" {
+		t.Errorf("got.IDs mismatch (-want +got):\n%s", diff)
+	}
+}
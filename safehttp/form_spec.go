@@ -0,0 +1,95 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FormSpec declares the parameters a handler accepts, in order to parse
+// forms strictly and prevent HTTP parameter pollution.
+//
+// A FormSpec can be checked against a parsed form with Form.Check. It can also
+// be passed as a Config to ServeMux.Handle, in which case it is checked
+// whenever the handler parses the query or the form of the request through
+// URL.Query, IncomingRequest.PostForm or IncomingRequest.MultipartForm, which
+// then return an error if the form doesn't satisfy the FormSpec. File uploads
+// of multipart forms are not checked.
+//
+// Parameters read by interceptors, e.g. the XSRF token, must be declared as
+// well.
+type FormSpec struct {
+	// Single lists the parameters that can have at most one value.
+	Single []string
+	// Multi lists the parameters that can have any number of values.
+	Multi []string
+	// MaxParams is the maximum number of parameter values in the form. If
+	// zero, the number is unlimited.
+	MaxParams int
+	// MaxSize is the maximum total size in bytes of the names and the values
+	// of the parameters in the form. If zero, the size is unlimited.
+	MaxSize int
+}
+
+// Match returns false, since a FormSpec doesn't configure any Interceptor. It
+// is needed to pass a FormSpec to ServeMux.Handle.
+func (FormSpec) Match(Interceptor) bool {
+	return false
+}
+
+// Check returns an error if the form contains a repeated parameter declared as
+// single-valued, a parameter that isn't declared, or more parameters than
+// allowed by the FormSpec.
+func (f *Form) Check(spec FormSpec) error {
+	single := map[string]bool{}
+	for _, p := range spec.Single {
+		single[p] = true
+	}
+	multi := map[string]bool{}
+	for _, p := range spec.Multi {
+		multi[p] = true
+	}
+
+	names := make([]string, 0, len(f.values))
+	count, size := 0, 0
+	for name, vals := range f.values {
+		names = append(names, name)
+		count += len(vals)
+		for _, v := range vals {
+			size += len(name) + len(v)
+		}
+	}
+	if spec.MaxParams > 0 && count > spec.MaxParams {
+		return fmt.Errorf("too many parameters: got %d, want at most %d", count, spec.MaxParams)
+	}
+	if spec.MaxSize > 0 && size > spec.MaxSize {
+		return fmt.Errorf("parameters too large: got %d bytes, want at most %d", size, spec.MaxSize)
+	}
+
+	sort.Strings(names)
+	for _, name := range names {
+		switch {
+		case single[name]:
+			if n := len(f.values[name]); n > 1 {
+				return fmt.Errorf("parameter %q repeated %d times", name, n)
+			}
+		case multi[name]:
+		default:
+			return fmt.Errorf("undeclared parameter %q", name)
+		}
+	}
+	return nil
+}
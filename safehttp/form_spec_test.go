@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFormCheck(t *testing.T) {
+	spec := FormSpec{
+		Single:    []string{"name", "page"},
+		Multi:     []string{"tag"},
+		MaxParams: 5,
+		MaxSize:   40,
+	}
+	tests := []struct {
+		name    string
+		values  map[string][]string
+		wantErr bool
+	}{
+		{
+			name:   "Valid",
+			values: map[string][]string{"name": {"pizza"}, "tag": {"a", "b", "c"}},
+		},
+		{
+			name:   "Empty",
+			values: map[string][]string{},
+		},
+		{
+			name:    "Repeated single parameter",
+			values:  map[string][]string{"name": {"pizza", "pasta"}},
+			wantErr: true,
+		},
+		{
+			name:    "Undeclared parameter",
+			values:  map[string][]string{"name": {"pizza"}, "admin": {"true"}},
+			wantErr: true,
+		},
+		{
+			name:    "Too many parameters",
+			values:  map[string][]string{"name": {"pizza"}, "tag": {"a", "b", "c", "d", "e"}},
+			wantErr: true,
+		},
+		{
+			name:    "Too large",
+			values:  map[string][]string{"name": {strings.Repeat("a", 40)}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Form{values: tt.values}
+			err := f.Check(spec)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("f.Check(spec) got err: %v want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormSpecRequest(t *testing.T) {
+	spec := &FormSpec{Single: []string{"name"}}
+	tests := []struct {
+		name    string
+		req     *http.Request
+		parse   func(r *IncomingRequest) error
+		wantErr bool
+	}{
+		{
+			name: "Valid query",
+			req:  httptest.NewRequest(MethodGet, "/?name=pizza", nil),
+			parse: func(r *IncomingRequest) error {
+				_, err := r.URL.Query()
+				return err
+			},
+		},
+		{
+			name: "Polluted query",
+			req:  httptest.NewRequest(MethodGet, "/?name=pizza&name=pasta", nil),
+			parse: func(r *IncomingRequest) error {
+				_, err := r.URL.Query()
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Valid post form",
+			req:  newFormRequest("name=pizza"),
+			parse: func(r *IncomingRequest) error {
+				_, err := r.PostForm()
+				return err
+			},
+		},
+		{
+			name: "Polluted post form",
+			req:  newFormRequest("name=pizza&name=pasta"),
+			parse: func(r *IncomingRequest) error {
+				_, err := r.PostForm()
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Undeclared multipart parameter",
+			req:  newMultipartRequest("admin", "true"),
+			parse: func(r *IncomingRequest) error {
+				_, err := r.MultipartForm(1024)
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Valid multipart form",
+			req:  newMultipartRequest("name", "pizza"),
+			parse: func(r *IncomingRequest) error {
+				_, err := r.MultipartForm(1024)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ir := NewIncomingRequest(tt.req)
+			ir.formSpec = spec
+			ir.URL.formSpec = spec
+
+			err := tt.parse(ir)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("parsing got err: %v want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func newFormRequest(body string) *http.Request {
+	req := httptest.NewRequest(MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req
+}
+
+func newMultipartRequest(name, value string) *http.Request {
+	body := "--123\r\n" +
+		"Content-Disposition: form-data; name=\"" + name + "\"\r\n" +
+		"\r\n" +
+		value + "\r\n" +
+		"--123--\r\n"
+	req := httptest.NewRequest(MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", `multipart/form-data; boundary="123"`)
+	return req
+}
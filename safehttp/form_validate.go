@@ -0,0 +1,181 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule validates the values of a form parameter. It receives all the values of
+// the parameter, which are empty if the parameter is missing, and returns an
+// error describing why they are invalid, if they are.
+//
+// Except for Required and MaxValues, the rules provided by this package
+// validate each value separately, so that missing parameters are valid.
+type Rule func(vals []string) error
+
+// Rules maps form parameters to the rules their values must satisfy. Rules can
+// be declared next to the route they are used on, e.g.
+//
+//	var searchRules = safehttp.Rules{
+//		"q":    {safehttp.Required(), safehttp.MaxLength(100)},
+//		"sort": {safehttp.OneOf("date", "relevance")},
+//	}
+type Rules map[string][]Rule
+
+// Validate validates the form against the rules and returns a FieldError for
+// each parameter whose values don't satisfy them, ordered by parameter name,
+// or nil if all of them do. Only the first rule a parameter fails is reported.
+func (f *Form) Validate(rules Rules) FieldErrors {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs FieldErrors
+	for _, name := range names {
+		for _, rule := range rules[name] {
+			if err := rule(f.values[name]); err != nil {
+				errs = append(errs, &FieldError{Field: name, Err: err})
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// MarshalJSON encodes the FieldError as a JSON object with "field" and "error"
+// keys, so that it can be sent in a JSON response, e.g. with a 422
+// Unprocessable Entity status code.
+func (e *FieldError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Field string `json:"field"`
+		Error string `json:"error"`
+	}{Field: e.Field, Error: e.Err.Error()})
+}
+
+// Required requires the parameter to be present with a non-empty first value.
+func Required() Rule {
+	return func(vals []string) error {
+		if len(vals) == 0 || vals[0] == "" {
+			return ErrMissingParam
+		}
+		return nil
+	}
+}
+
+// MaxValues requires the parameter to have at most n values.
+func MaxValues(n int) Rule {
+	return func(vals []string) error {
+		if len(vals) > n {
+			return fmt.Errorf("must have at most %d values", n)
+		}
+		return nil
+	}
+}
+
+// MinLength requires each value to be at least n characters long.
+func MinLength(n int) Rule {
+	return eachValue(func(v string) error {
+		if utf8.RuneCountInString(v) < n {
+			return fmt.Errorf("must be at least %d characters long", n)
+		}
+		return nil
+	})
+}
+
+// MaxLength requires each value to be at most n characters long.
+func MaxLength(n int) Rule {
+	return eachValue(func(v string) error {
+		if utf8.RuneCountInString(v) > n {
+			return fmt.Errorf("must be at most %d characters long", n)
+		}
+		return nil
+	})
+}
+
+// Pattern requires each value to entirely match the regular expression.
+func Pattern(re *regexp.Regexp) Rule {
+	full := regexp.MustCompile(`^(?:` + re.String() + `)$`)
+	return eachValue(func(v string) error {
+		if !full.MatchString(v) {
+			return fmt.Errorf("must match %s", re)
+		}
+		return nil
+	})
+}
+
+// OneOf requires each value to be one of the allowed values.
+func OneOf(allowed ...string) Rule {
+	return eachValue(func(v string) error {
+		for _, a := range allowed {
+			if v == a {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(allowed, ", "))
+	})
+}
+
+// IntRange requires each value to be an integer between min and max,
+// inclusive.
+func IntRange(min, max int64) Rule {
+	return eachValue(func(v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return errors.New("must be an integer")
+		}
+		if n < min || n > max {
+			return fmt.Errorf("must be between %d and %d", min, max)
+		}
+		return nil
+	})
+}
+
+// FloatRange requires each value to be a number between min and max,
+// inclusive. NaN is always rejected, and infinities are only accepted if they
+// are within the bounds.
+func FloatRange(min, max float64) Rule {
+	return eachValue(func(v string) error {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(n) {
+			return errors.New("must be a number")
+		}
+		if n < min || n > max {
+			return fmt.Errorf("must be between %g and %g", min, max)
+		}
+		return nil
+	})
+}
+
+func eachValue(check func(v string) error) Rule {
+	return func(vals []string) error {
+		for _, v := range vals {
+			if err := check(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"regexp"
+	"testing"
+)
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		vals    []string
+		wantErr bool
+	}{
+		{name: "Required present", rule: Required(), vals: []string{"a"}},
+		{name: "Required missing", rule: Required(), wantErr: true},
+		{name: "Required empty", rule: Required(), vals: []string{""}, wantErr: true},
+		{name: "MaxValues", rule: MaxValues(2), vals: []string{"a", "b"}},
+		{name: "MaxValues exceeded", rule: MaxValues(2), vals: []string{"a", "b", "c"}, wantErr: true},
+		{name: "MinLength", rule: MinLength(3), vals: []string{"abc"}},
+		{name: "MinLength missing", rule: MinLength(3)},
+		{name: "MinLength too short", rule: MinLength(3), vals: []string{"abc", "ab"}, wantErr: true},
+		{name: "MaxLength multibyte", rule: MaxLength(3), vals: []string{"äöü"}},
+		{name: "MaxLength too long", rule: MaxLength(3), vals: []string{"abcd"}, wantErr: true},
+		{name: "Pattern", rule: Pattern(regexp.MustCompile("[a-z]+")), vals: []string{"abc"}},
+		{name: "Pattern partial match", rule: Pattern(regexp.MustCompile("[a-z]+")), vals: []string{"abc1"}, wantErr: true},
+		{name: "Pattern full match of later alternative", rule: Pattern(regexp.MustCompile("[a-z]+|[a-z]+[0-9]")), vals: []string{"abc1"}},
+		{name: "Pattern with flags", rule: Pattern(regexp.MustCompile("(?i)abc")), vals: []string{"ABC"}},
+		{name: "OneOf", rule: OneOf("date", "relevance"), vals: []string{"date"}},
+		{name: "OneOf not allowed", rule: OneOf("date", "relevance"), vals: []string{"price"}, wantErr: true},
+		{name: "IntRange", rule: IntRange(1, 10), vals: []string{"10"}},
+		{name: "IntRange out of range", rule: IntRange(1, 10), vals: []string{"11"}, wantErr: true},
+		{name: "IntRange not a number", rule: IntRange(1, 10), vals: []string{"ten"}, wantErr: true},
+		{name: "FloatRange", rule: FloatRange(0, 1), vals: []string{"0.5"}},
+		{name: "FloatRange out of range", rule: FloatRange(0, 1), vals: []string{"1.5"}, wantErr: true},
+		{name: "FloatRange not a number", rule: FloatRange(0, 1), vals: []string{"half"}, wantErr: true},
+		{name: "FloatRange NaN", rule: FloatRange(0, 10), vals: []string{"NaN"}, wantErr: true},
+		{name: "FloatRange infinity", rule: FloatRange(0, 10), vals: []string{"+Inf"}, wantErr: true},
+		{name: "FloatRange infinity within bounds", rule: FloatRange(0, math.Inf(1)), vals: []string{"+Inf"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule(tt.vals)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("rule(%q) got err: %v want error: %v", tt.vals, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFormValidate(t *testing.T) {
+	rules := Rules{
+		"q":     {Required(), MaxLength(5)},
+		"sort":  {OneOf("date", "relevance")},
+		"page":  {IntRange(1, 100)},
+		"lang":  {MinLength(2)},
+		"extra": {MaxValues(1)},
+	}
+	f := Form{values: map[string][]string{
+		"q":     {"pizzeria"},
+		"sort":  {"price"},
+		"page":  {"3"},
+		"extra": {"a"},
+	}}
+
+	errs := f.Validate(rules)
+
+	if len(errs) != 2 {
+		t.Fatalf("f.Validate(rules) got: %v want: 2 errors", errs)
+	}
+	if got, want := errs[0].Field, "q"; got != want {
+		t.Errorf("errs[0].Field got: %q want: %q", got, want)
+	}
+	if got, want := errs[1].Field, "sort"; got != want {
+		t.Errorf("errs[1].Field got: %q want: %q", got, want)
+	}
+
+	b, err := json.Marshal(errs)
+	if err != nil {
+		t.Fatalf("json.Marshal(errs) got err: %v want: nil", err)
+	}
+	want := `[{"field":"q","error":"must be at most 5 characters long"},{"field":"sort","error":"must be one of date, relevance"}]`
+	if got := string(b); got != want {
+		t.Errorf("json.Marshal(errs) got: %s want: %s", got, want)
+	}
+}
+
+func TestFormValidateValid(t *testing.T) {
+	f := Form{values: map[string][]string{"q": {"pizza"}}}
+	errs := f.Validate(Rules{"q": {Required()}, "page": {IntRange(1, 100)}})
+	if errs != nil {
+		t.Errorf("f.Validate(rules) got: %v want: nil", errs)
+	}
+}
+
+func TestFormValidateRequired(t *testing.T) {
+	f := Form{values: map[string][]string{}}
+	errs := f.Validate(Rules{"q": {Required(), MinLength(3)}})
+	if len(errs) != 1 || !errors.Is(errs[0], ErrMissingParam) {
+		t.Errorf("f.Validate(rules) got: %v want: a single missing q error", errs)
+	}
+}
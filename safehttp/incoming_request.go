@@ -15,10 +15,15 @@
 package safehttp
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net"
 	"net/http"
 	"strings"
 	"sync"
@@ -30,27 +35,77 @@ type IncomingRequest struct {
 	Header             Header
 	postParseOnce      sync.Once
 	multipartParseOnce sync.Once
+	jsonParseOnce      sync.Once
+	jsonBody           []byte
+	jsonErr            error
 	TLS                *tls.ConnectionState
 	URL                *URL
+	pathParams         PathParams
+	formSpec           *FormSpec
+	clientIP           net.IP
+	scheme             string
+	host               string
 }
 
 // NewIncomingRequest creates an IncomingRequest
 // from an http.Request.
 func NewIncomingRequest(req *http.Request) *IncomingRequest {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
 	return &IncomingRequest{
-		req:    req,
-		Header: newHeader(req.Header),
-		TLS:    req.TLS,
-		URL:    &URL{url: req.URL},
+		req:      req,
+		Header:   newHeader(req.Header),
+		TLS:      req.TLS,
+		URL:      &URL{url: req.URL},
+		clientIP: remoteIP(req),
+		scheme:   scheme,
+		host:     req.Host,
 	}
 }
 
 // Body returns the request body reader. It is always non-nil but will return
 // EOF immediately when no body is present.
+//
+// When the request is served by a ServeMux, reading more than the maximum body
+// size of the route fails with ErrBodyTooLarge. The limit applies to the
+// parsing of forms and JSON bodies as well.
 func (r *IncomingRequest) Body() io.ReadCloser {
 	return r.req.Body
 }
 
+// PathParams returns the values of the parameters of the pattern the handler
+// was registered with. See ServeMux for more details on patterns.
+func (r *IncomingRequest) PathParams() *PathParams {
+	return &r.pathParams
+}
+
+// ClientIP returns the IP address of the client that sent the request, or nil
+// if it's unknown. If the request has been received from a proxy trusted by
+// the ServeMux, it's the address reported by the proxy. See
+// ServeMux.SetTrustedProxies for more details.
+func (r *IncomingRequest) ClientIP() net.IP {
+	return r.clientIP
+}
+
+// Scheme returns the scheme used by the client to send the request, either
+// "http" or "https". If the request has been received from a proxy trusted by
+// the ServeMux, it's the scheme reported by the proxy.
+func (r *IncomingRequest) Scheme() string {
+	return r.scheme
+}
+
+// Host returns the host the client sent the request to, as found in the Host
+// header. If the request has been received from a proxy trusted by the
+// ServeMux, it's the host reported by the proxy, if any.
+//
+// Note that the ServeMux matches the allowed domains and the patterns against
+// the Host header of the request, not against the host reported by proxies.
+func (r *IncomingRequest) Host() string {
+	return r.host
+}
+
 // Method returns the HTTP method of the IncomingRequest.
 func (r *IncomingRequest) Method() string {
 	return r.req.Method
@@ -62,6 +117,9 @@ func (r *IncomingRequest) Method() string {
 // error occurs it will return it, together with a nil Form. Unless we expect
 // the header Content-Type: multipart/form-data in a POST request, this method
 // should  always be used for forms in POST requests.
+//
+// If the request is served by a route registered with a FormSpec, an error is
+// also returned if the form doesn't satisfy it.
 func (r *IncomingRequest) PostForm() (*Form, error) {
 	var err error
 	r.postParseOnce.Do(func() {
@@ -80,7 +138,13 @@ func (r *IncomingRequest) PostForm() (*Form, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Form{values: r.req.PostForm}, nil
+	f := &Form{values: r.req.PostForm}
+	if r.formSpec != nil {
+		if err := f.Check(*r.formSpec); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
 }
 
 // MultipartForm parses the form parameters provided in the body of a POST,
@@ -91,7 +155,11 @@ func (r *IncomingRequest) PostForm() (*Form, error) {
 //
 // If the parsed request body is larger than maxMemory, up to maxMemory bytes
 // will be stored in main memory, with the rest stored on disk in temporary
-// files.
+// files. Use MultipartReader instead to stream the form and check the
+// uploaded files.
+//
+// If the request is served by a route registered with a FormSpec, an error is
+// also returned if the form values don't satisfy it.
 func (r *IncomingRequest) MultipartForm(maxMemory int64) (*MultipartForm, error) {
 	var err error
 	r.multipartParseOnce.Do(func() {
@@ -109,13 +177,73 @@ func (r *IncomingRequest) MultipartForm(maxMemory int64) (*MultipartForm, error)
 	if err != nil {
 		return nil, err
 	}
-	return &MultipartForm{
-			Form: Form{
-				values: r.req.MultipartForm.Value,
-			},
-			mf: r.req.MultipartForm,
+	f := &MultipartForm{
+		Form: Form{
+			values: r.req.MultipartForm.Value,
 		},
-		nil
+		mf: r.req.MultipartForm,
+	}
+	if r.formSpec != nil {
+		if err := f.Check(*r.formSpec); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// DecodeJSON decodes the JSON body of a POST, PATCH or PUT request with
+// Content-Type: application/json into v. The body is read only once, so that
+// DecodeJSON can be called multiple times, e.g. to decode the same body into
+// different types.
+//
+// The body must consist of a single JSON value and must not contain fields that
+// don't exist in v. Otherwise, or if v can't be decoded from the body,
+// DecodeJSON returns a *RequestError with a 400 Bad Request status code. If the
+// Content-Type of the request isn't JSON, the status code is 415 Unsupported
+// Media Type instead, and if the body exceeds the maximum body size of the
+// route (see MaxBodySize), 413 Request Entity Too Large.
+func (r *IncomingRequest) DecodeJSON(v interface{}) error {
+	r.jsonParseOnce.Do(func() {
+		if m := r.req.Method; m != MethodPost && m != MethodPatch && m != MethodPut {
+			r.jsonErr = &RequestError{Code: StatusBadRequest, Err: fmt.Errorf("got request method %s, want POST/PATCH/PUT", m)}
+			return
+		}
+
+		ct := r.req.Header.Get("Content-Type")
+		mt, params, err := mime.ParseMediaType(ct)
+		if err != nil || mt != "application/json" {
+			r.jsonErr = &RequestError{Code: StatusUnsupportedMediaType, Err: fmt.Errorf("invalid method called for Content-Type: %s", ct)}
+			return
+		}
+		if cs, ok := params["charset"]; ok && !strings.EqualFold(cs, "utf-8") {
+			r.jsonErr = &RequestError{Code: StatusUnsupportedMediaType, Err: fmt.Errorf("unsupported charset: %s", cs)}
+			return
+		}
+
+		b, err := io.ReadAll(r.req.Body)
+		if errors.Is(err, ErrBodyTooLarge) {
+			r.jsonErr = &RequestError{Code: StatusRequestEntityTooLarge, Err: err}
+			return
+		}
+		if err != nil {
+			r.jsonErr = &RequestError{Code: StatusBadRequest, Err: err}
+			return
+		}
+		r.jsonBody = b
+	})
+	if r.jsonErr != nil {
+		return r.jsonErr
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(r.jsonBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &RequestError{Code: StatusBadRequest, Err: err}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &RequestError{Code: StatusBadRequest, Err: errors.New("unexpected data after the JSON value")}
+	}
+	return nil
 }
 
 // Cookie returns the named cookie provided in the request or
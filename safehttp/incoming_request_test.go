@@ -16,6 +16,7 @@ package safehttp_test
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -451,3 +452,140 @@ func TestIncomingRequestFileUploadMissingContent(t *testing.T) {
 		t.Errorf("file.Read(content): got %s, want %s", got, want)
 	}
 }
+
+func TestIncomingRequestDecodeJSON(t *testing.T) {
+	type payload struct {
+		Name string
+		Tags []string
+	}
+
+	contentTypes := []string{
+		"application/json",
+		"application/json; charset=utf-8",
+		"application/json; charset=UTF-8",
+	}
+
+	for _, ct := range contentTypes {
+		t.Run(ct, func(t *testing.T) {
+			r := safehttptest.NewRequest(safehttp.MethodPost, "/", strings.NewReader(`{"Name": "pizza", "Tags": ["a", "b"]}`))
+			r.Header.Set("Content-Type", ct)
+
+			var got payload
+			if err := r.DecodeJSON(&got); err != nil {
+				t.Fatalf("r.DecodeJSON(&got) got: %v want: nil", err)
+			}
+			want := payload{Name: "pizza", Tags: []string{"a", "b"}}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Errorf("r.DecodeJSON(&got) mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIncomingRequestDecodeJSONTwice(t *testing.T) {
+	r := safehttptest.NewRequest(safehttp.MethodPut, "/", strings.NewReader(`{"Name": "pizza"}`))
+	r.Header.Set("Content-Type", "application/json")
+
+	var first struct{ Name string }
+	if err := r.DecodeJSON(&first); err != nil {
+		t.Fatalf("r.DecodeJSON(&first) got: %v want: nil", err)
+	}
+	var second map[string]string
+	if err := r.DecodeJSON(&second); err != nil {
+		t.Fatalf("r.DecodeJSON(&second) got: %v want: nil", err)
+	}
+	if got, want := second["Name"], first.Name; got != want {
+		t.Errorf(`second["Name"] got: %q want: %q`, got, want)
+	}
+}
+
+func TestIncomingRequestInvalidDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		contentType string
+		body        string
+		wantCode    safehttp.StatusCode
+	}{
+		{
+			name:        "GET method",
+			method:      safehttp.MethodGet,
+			contentType: "application/json",
+			body:        `{"Name": "pizza"}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:     "Missing content type",
+			method:   safehttp.MethodPost,
+			body:     `{"Name": "pizza"}`,
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Wrong content type",
+			method:      safehttp.MethodPost,
+			contentType: "text/plain",
+			body:        `{"Name": "pizza"}`,
+			wantCode:    safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Wrong charset",
+			method:      safehttp.MethodPost,
+			contentType: "application/json; charset=utf-16",
+			body:        `{"Name": "pizza"}`,
+			wantCode:    safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Empty body",
+			method:      safehttp.MethodPost,
+			contentType: "application/json",
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "Malformed",
+			method:      safehttp.MethodPost,
+			contentType: "application/json",
+			body:        `{"Name": `,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "Unknown field",
+			method:      safehttp.MethodPost,
+			contentType: "application/json",
+			body:        `{"Name": "pizza", "Admin": true}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "Wrong type",
+			method:      safehttp.MethodPost,
+			contentType: "application/json",
+			body:        `{"Name": 42}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+		{
+			name:        "Trailing data",
+			method:      safehttp.MethodPost,
+			contentType: "application/json",
+			body:        `{"Name": "pizza"} {"Name": "pasta"}`,
+			wantCode:    safehttp.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := safehttptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+
+			var v struct{ Name string }
+			err := r.DecodeJSON(&v)
+			var re *safehttp.RequestError
+			if !errors.As(err, &re) {
+				t.Fatalf("r.DecodeJSON(&v) got: %v want: *safehttp.RequestError", err)
+			}
+			if re.Code != tt.wantCode {
+				t.Errorf("re.Code got: %v want: %v", re.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -16,11 +16,26 @@ package safehttp
 
 // Interceptor can be installed on a ServeMux in order to apply its
 // functionality on an IncomingRequest before it is sent to its corresponding
-// handler.
+// handler and on the response before and after it is written.
+//
+// The Commit and After stages only run for the interceptors whose Before stage
+// has run, in the reverse order of installation.
 type Interceptor interface {
 	// Before runs before the IncomingRequest is sent to the handler. If a
 	// response is written to the ResponseWriter, then the remaining
 	// interceptors and the handler won't execute. If Before panics, it will be
 	// recovered and the ServeMux will respond with 500 Internal Server Error.
 	Before(w *ResponseWriter, r *IncomingRequest, cfg interface{}) Result
+
+	// Commit runs right before the response is committed, i.e. before its
+	// status code and headers are sent, regardless of which method of the
+	// ResponseWriter was used to write it. The status code of the response is
+	// available through ResponseWriter.Status and its headers can still be
+	// modified. A response can't be written from Commit.
+	Commit(w *ResponseWriter, r *IncomingRequest, cfg interface{})
+
+	// After runs after the response has been written, including when it was
+	// written by an interceptor. The status code and headers of the response
+	// are available through the ResponseWriter but can no longer be modified.
+	After(w *ResponseWriter, r *IncomingRequest, cfg interface{})
 }
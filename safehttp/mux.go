@@ -15,7 +15,13 @@
 package safehttp
 
 import (
+	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"sort"
+	"strings"
 )
 
 const (
@@ -69,31 +75,69 @@ const (
 // header, stripping the port number and redirecting any request containing . or
 // .. elements or repeated slashes to an equivalent, cleaner URL.
 //
+// Patterns can contain parameters, written as {name}, that span a whole path
+// segment, like "/users/{id}/posts/{postID}". A parameter matches any single,
+// non-empty path segment other than . and .., and its value can be retrieved
+// in the handler through IncomingRequest.PathParams. When multiple patterns
+// with parameters match a path, the one with a literal segment at the first
+// position where they differ takes precedence, so that "/users/me" is preferred
+// over "/users/{id}". A request matching none of the patterns with parameters
+// is served by the handler of the longest rooted subtree matching it, if any.
+//
 // Multiple handlers can be registered for a single pattern, as long as they
 // handle different HTTP methods.
+//
+// Requests that can't be served, e.g. because no pattern matches them or
+// because no handler is registered for their method, are answered with an
+// error response written through ResponseWriter.WriteError. Error responses
+// can be customised by providing a Dispatcher implementing ErrorRenderer.
+// Errors that can't be returned to the handlers, like Dispatcher failures and
+// recovered panics, are reported to the ErrorHook set through SetErrorHook.
+//
+// The size of request bodies is limited to DefaultMaxBodySize, unless changed
+// with SetMaxBodySize or overridden on specific routes by passing a
+// MaxBodySize to Handle. Requests declaring a larger Content-Length are
+// answered with a 413 Request Entity Too Large error once the Before stage of
+// the interceptors ran, without calling the handler, and reading more than the
+// limit from other requests fails with ErrBodyTooLarge.
 type ServeMux struct {
 	mux     *http.ServeMux
 	domains map[string]bool
 	disp    Dispatcher
 
 	// Maps patterns to handlers supporting multiple HTTP methods.
-	handlers  map[string]methodHandler
-	interceps []Interceptor
+	handlers map[string]*methodHandler
+	// Maps the patterns registered in mux to their routers.
+	routers     map[string]*router
+	interceps   []Interceptor
+	errHook     ErrorHook
+	maxBodySize int64
+	proxies     trustedProxies
 }
 
-// NewServeMux allocates and returns a new ServeMux
+// NewServeMux allocates and returns a new ServeMux. If the provided Dispatcher
+// is nil, DefaultDispatcher is used.
 func NewServeMux(d Dispatcher, domains ...string) *ServeMux {
+	if d == nil {
+		d = DefaultDispatcher{}
+	}
 	// TODO(@mattiasgrenfeldt, @mihalimara22): make domains a variadic of string **literals**.
 	dm := map[string]bool{}
 	for _, host := range domains {
 		dm[host] = true
 	}
-	return &ServeMux{
-		mux:      http.NewServeMux(),
-		domains:  dm,
-		disp:     d,
-		handlers: map[string]methodHandler{},
+	m := &ServeMux{
+		mux:         http.NewServeMux(),
+		domains:     dm,
+		disp:        d,
+		handlers:    map[string]*methodHandler{},
+		routers:     map[string]*router{},
+		maxBodySize: DefaultMaxBodySize,
 	}
+	// Register a router for "/" so that requests not matching any pattern
+	// still get their 404 Not Found response written through the Dispatcher.
+	m.router("/")
+	return m
 }
 
 type appliedInterceptor struct {
@@ -103,12 +147,33 @@ type appliedInterceptor struct {
 
 // Handle registers a handler for the given pattern and method. If another
 // handler is already registered for the same pattern and method, Handle panics.
+// Handle also panics if the pattern is invalid or if it matches exactly the
+// same paths as another pattern with different parameter names.
 //
 // Configs can be optionally passed in order to modify the behavior of the
 // interceptors on a registered handler. Passing a Config whose corresponding
 // Interceptor was not installed will produce no effect. If multiple Configs are
-// passed for the same Interceptor, only the first one will take effect.
+// passed for the same Interceptor, only the first one will take effect. Handle
+// panics if a ValidatedConfig is invalid. See OptionsConfig for the Configs
+// whose interceptors also answer OPTIONS requests.
+//
+// A FormSpec can also be passed in order to parse the forms of the requests
+// strictly, and a MaxBodySize in order to override the maximum size of the
+// request bodies. If multiple ones of either are passed, only the first one
+// will take effect.
 func (m *ServeMux) Handle(pattern string, method string, h Handler, cfgs ...Config) {
+	handleOptions := false
+	for _, c := range cfgs {
+		if vc, ok := c.(ValidatedConfig); ok {
+			if err := vc.Validate(); err != nil {
+				panic(fmt.Sprintf("invalid config for pattern %q: %v", pattern, err))
+			}
+		}
+		if oc, ok := c.(OptionsConfig); ok && oc.HandleOptions() {
+			handleOptions = true
+		}
+	}
+
 	var interceps []appliedInterceptor
 	for _, it := range m.interceps {
 		var cfg Config
@@ -123,25 +188,204 @@ func (m *ServeMux) Handle(pattern string, method string, h Handler, cfgs ...Conf
 	hi := handlerWithInterceptors{
 		handler:   h,
 		interceps: interceps,
-		disp:      m.disp,
+		mux:       m,
+		cfgs:      cfgs,
+	}
+	for _, c := range cfgs {
+		if spec, ok := c.(FormSpec); ok {
+			hi.formSpec = &spec
+			break
+		}
+	}
+	for _, c := range cfgs {
+		if max, ok := c.(MaxBodySize); ok {
+			hi.maxBodySize = &max
+			break
+		}
 	}
 
 	mh, ok := m.handlers[pattern]
 	if !ok {
-		mh := methodHandler{
-			handlers: map[string]handlerWithInterceptors{method: hi},
+		mh = &methodHandler{
+			handlers: map[string]handlerWithInterceptors{},
 			domains:  m.domains,
+			mux:      m,
 		}
-
+		m.route(pattern, mh)
 		m.handlers[pattern] = mh
-		m.mux.Handle(pattern, mh)
-		return
 	}
 
 	if _, ok := mh.handlers[method]; ok {
 		panic("method already registered")
 	}
 	mh.handlers[method] = hi
+
+	if handleOptions && mh.options == nil {
+		opts := hi
+		opts.handler = HandlerFunc(func(w *ResponseWriter, r *IncomingRequest) Result {
+			return w.WriteError(StatusMethodNotAllowed)
+		})
+		mh.options = &opts
+	}
+}
+
+// route adds the methodHandler of a newly registered pattern to the router
+// responsible for it, creating and registering the router if needed.
+func (m *ServeMux) route(pattern string, mh *methodHandler) {
+	p, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	key := p.muxPattern()
+	rt := m.router(key)
+	if !p.hasParams() {
+		rt.exact = mh
+		return
+	}
+	// http.ServeMux redirects requests for the parent of a rooted subtree,
+	// e.g. /users for /users/, to the subtree. The subtree registered for
+	// the parameters of the pattern must not do that, as the parent path
+	// can be matched by other patterns, e.g. /{id} for /users/{id}.
+	if path := key[strings.Index(key, "/"):]; path != "/" {
+		m.router(strings.TrimSuffix(key, "/"))
+	}
+	for _, pr := range rt.params {
+		if p.conflicts(pr.pattern) {
+			panic(fmt.Sprintf("pattern %q conflicts with an already registered pattern", pattern))
+		}
+	}
+	i := sort.Search(len(rt.params), func(i int) bool {
+		return p.moreSpecific(rt.params[i].pattern)
+	})
+	rt.params = append(rt.params, paramRoute{})
+	copy(rt.params[i+1:], rt.params[i:])
+	rt.params[i] = paramRoute{pattern: p, handler: mh}
+}
+
+// router returns the router registered for key in the underlying
+// http.ServeMux, creating and registering it if needed.
+func (m *ServeMux) router(key string) *router {
+	rt, ok := m.routers[key]
+	if !ok {
+		rt = &router{mux: m, key: key}
+		m.routers[key] = rt
+		m.mux.Handle(key, rt)
+	}
+	return rt
+}
+
+// fallback returns the methodHandler, and the values of the parameters, of
+// the pattern with the highest precedence matching the request among the
+// rooted subtrees other than key. As in http.ServeMux, host-specific subtrees
+// take precedence over the other ones, and the port of the request's host is
+// ignored. Longer subtrees take precedence over shorter ones and, within a
+// subtree, patterns with parameters take precedence over the subtree pattern
+// itself.
+func (m *ServeMux) fallback(r *http.Request, key string) (*methodHandler, map[string]string) {
+	host := stripHostPort(r.Host)
+	var keys []string
+	for k := range m.routers {
+		if k == key || !strings.HasSuffix(k, "/") {
+			continue
+		}
+		if strings.HasPrefix(r.URL.Path, k) || strings.HasPrefix(host+r.URL.Path, k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		hostI, hostJ := !strings.HasPrefix(keys[i], "/"), !strings.HasPrefix(keys[j], "/")
+		if hostI != hostJ {
+			return hostI
+		}
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		rt := m.routers[k]
+		for _, pr := range rt.params {
+			if params, ok := pr.pattern.match(r.URL.Path); ok {
+				return pr.handler, params
+			}
+		}
+		if rt.exact != nil {
+			return rt.exact, nil
+		}
+	}
+	return nil, nil
+}
+
+// stripHostPort returns h without any trailing ":<port>".
+func stripHostPort(h string) string {
+	if !strings.Contains(h, ":") {
+		return h
+	}
+	host, _, err := net.SplitHostPort(h)
+	if err != nil {
+		return h
+	}
+	return host
+}
+
+// SetErrorHook sets the ErrorHook called with the errors that occur while
+// serving requests. It must be called before the ServeMux starts serving
+// requests.
+func (m *ServeMux) SetErrorHook(h ErrorHook) {
+	m.errHook = h
+}
+
+// SetMaxBodySize sets the maximum size in bytes of request bodies on the
+// routes that don't override it with a MaxBodySize. If n is zero or negative,
+// the size of request bodies is unlimited. It must be called before the
+// ServeMux starts serving requests.
+func (m *ServeMux) SetMaxBodySize(n int64) {
+	m.maxBodySize = n
+}
+
+// Route describes a handler registered on a ServeMux.
+type Route struct {
+	// Pattern is the pattern the handler was registered with.
+	Pattern string
+	// Method is the HTTP method the handler was registered with.
+	Method string
+	// Configs are the Configs passed to Handle when the handler was
+	// registered.
+	Configs []Config
+}
+
+// Routes returns the routes registered on the ServeMux, sorted by pattern and
+// method. It can be used to audit the configuration of the routes, e.g. to
+// find the ones relaxing the security policies applied by the interceptors.
+func (m *ServeMux) Routes() []Route {
+	var routes []Route
+	for pattern, mh := range m.handlers {
+		for method, hi := range mh.handlers {
+			routes = append(routes, Route{
+				Pattern: pattern,
+				Method:  method,
+				Configs: append([]Config(nil), hi.cfgs...),
+			})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// newResponseWriter creates the ResponseWriter used to respond to the
+// IncomingRequest.
+func (m *ServeMux) newResponseWriter(w http.ResponseWriter, ir *IncomingRequest) *ResponseWriter {
+	rw := NewResponseWriter(m.disp, w)
+	rw.req = ir
+	rw.errHook = m.errHook
+	return rw
 }
 
 // Install installs an Interceptor.
@@ -155,28 +399,92 @@ func (m *ServeMux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	m.mux.ServeHTTP(w, r)
 }
 
+// paramRoute associates a pattern with parameters to its methodHandler.
+type paramRoute struct {
+	pattern pathPattern
+	handler *methodHandler
+}
+
+// router serves the requests that the underlying http.ServeMux dispatched to a
+// registered pattern. Patterns with parameters are registered in the
+// http.ServeMux through the rooted subtree preceding their first parameter,
+// along with the parent of the subtree so that http.ServeMux doesn't redirect
+// it to the subtree.
+type router struct {
+	mux *ServeMux
+	key string
+
+	// exact is the methodHandler of the pattern without parameters equal to
+	// key, if any.
+	exact *methodHandler
+	// params contains the patterns with parameters registered through key,
+	// sorted by decreasing precedence.
+	params []paramRoute
+}
+
+// ServeHTTP dispatches the request to the methodHandler of the pattern with
+// the highest precedence matching it.
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	for _, pr := range rt.params {
+		if params, ok := pr.pattern.match(r.URL.Path); ok {
+			pr.handler.serveHTTP(w, r, params)
+			return
+		}
+	}
+
+	if rt.exact != nil {
+		rt.exact.serveHTTP(w, r, nil)
+		return
+	}
+	// Keep redirecting the parent of a rooted subtree registered without
+	// parameters to the subtree, as http.ServeMux does.
+	if sub, ok := rt.mux.routers[rt.key+"/"]; ok && sub.exact != nil {
+		u := &url.URL{Path: r.URL.Path + "/", RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return
+	}
+	if mh, params := rt.mux.fallback(r, rt.key); mh != nil {
+		mh.serveHTTP(w, r, params)
+		return
+	}
+	writeError(rt.mux, w, r, StatusNotFound)
+}
+
 // methodHandler is a collection of handlerWithInterceptors based on the request method.
 type methodHandler struct {
 	// Maps an HTTP method to its handlerWithInterceptors
 	handlers map[string]handlerWithInterceptors
-	domains  map[string]bool
+	// options serves the OPTIONS requests if no handler is registered for
+	// them and a handler was registered with an OptionsConfig.
+	options *handlerWithInterceptors
+	domains map[string]bool
+	mux     *ServeMux
 }
 
-// ServeHTTP dispatches the request to the handlerWithInterceptors associated
+// serveHTTP dispatches the request to the handlerWithInterceptors associated
 // with the IncomingRequest method.
-func (m methodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+func (m *methodHandler) serveHTTP(w http.ResponseWriter, r *http.Request, params map[string]string) {
 	if !m.domains[r.Host] {
-		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		writeError(m.mux, w, r, StatusNotFound)
 		return
 	}
 
 	h, ok := m.handlers[r.Method]
+	if !ok && r.Method == MethodOptions && m.options != nil {
+		h, ok = *m.options, true
+	}
 	if !ok {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		writeError(m.mux, w, r, StatusMethodNotAllowed)
 		return
 	}
 
-	h.ServeHTTP(w, r)
+	h.serveHTTP(w, r, params)
+}
+
+// writeError responds to the request with an error written through
+// ResponseWriter.WriteError. No interceptors are run.
+func writeError(m *ServeMux, w http.ResponseWriter, r *http.Request, code StatusCode) {
+	m.newResponseWriter(w, NewIncomingRequest(r)).WriteError(code)
 }
 
 // handlerWithInterceptors encapsulates a handler and its corresponding
@@ -184,33 +492,95 @@ func (m methodHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 type handlerWithInterceptors struct {
 	handler   Handler
 	interceps []appliedInterceptor
-	disp      Dispatcher
+	mux       *ServeMux
+	formSpec  *FormSpec
+	// cfgs are the Configs the handler was registered with.
+	cfgs []Config
+	// maxBodySize overrides the maximum body size of the ServeMux, if set.
+	maxBodySize *MaxBodySize
 }
 
-// ServeHTTP calls the Before method of all the interceptors and then calls the
-// underlying handler.
-func (h handlerWithInterceptors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rw := NewResponseWriter(h.disp, w)
+// serveHTTP calls the Before method of all the interceptors and then calls the
+// underlying handler. Once the response has been written, it calls the After
+// method of the interceptors whose Before method ran.
+func (h handlerWithInterceptors) serveHTTP(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	max := h.mux.maxBodySize
+	if h.maxBodySize != nil {
+		max = int64(*h.maxBodySize)
+	}
+	tooLarge := max > 0 && r.ContentLength > max
+	if max > 0 {
+		r.Body = newMaxBodyReader(w, r.Body, max)
+	}
+
 	ir := NewIncomingRequest(r)
+	h.mux.proxies.resolve(ir, r)
+	ir.pathParams.values = params
+	ir.formSpec = h.formSpec
+	ir.URL.formSpec = h.formSpec
+	rw := h.mux.newResponseWriter(w, ir)
 
 	// The `net/http` package recovers handler panics, but we cannot rely on that behavior here.
-	// The reason is, we might need to run After/Commit stages of the interceptors before we
+	// The reason is, we need to run the Commit and After stages of the interceptors when we
 	// respond with a 500 Internal Server Error.
 	defer func() {
+		abort := false
 		if r := recover(); r != nil {
-			rw.WriteError(StatusInternalServerError)
+			rw.report(&PanicError{Value: r, Stack: debug.Stack()})
+			switch {
+			case !rw.committed:
+				rw.written = true
+				rw.status = StatusInternalServerError
+				rw.writeError()
+			case !rw.sent:
+				// A Commit stage panicked, running them again would most
+				// likely panic as well.
+				rw.status = StatusInternalServerError
+				http.Error(rw.rw, http.StatusText(int(rw.status)), int(rw.status))
+				rw.sent = true
+			default:
+				// The response has been partially sent, the only thing left
+				// to do is to abort it.
+				abort = true
+			}
+		}
+		for i := len(rw.interceps) - 1; i >= 0; i-- {
+			it := rw.interceps[i]
+			it.it.After(rw, ir, it.cfg)
+		}
+		// Remove the temporary files of multipart forms, handlers don't need
+		// to call MultipartForm.RemoveFiles. The form is stored in the
+		// current request of the IncomingRequest, which is replaced by a
+		// copy whenever its context is changed.
+		if mf := ir.req.MultipartForm; mf != nil {
+			if err := mf.RemoveAll(); err != nil {
+				rw.report(err)
+			}
+		}
+		if abort {
+			panic(http.ErrAbortHandler)
 		}
 	}()
 
-	for _, interceptor := range h.interceps {
+	for i, interceptor := range h.interceps {
+		rw.interceps = h.interceps[:i+1]
 		interceptor.it.Before(rw, ir, interceptor.cfg)
 		if rw.written {
 			return
 		}
 	}
 
+	if tooLarge {
+		// The error goes through the interceptors like any other response,
+		// so that they can e.g. set their headers or log it.
+		rw.WriteError(StatusRequestEntityTooLarge)
+		return
+	}
+
 	h.handler.ServeHTTP(rw, ir)
 	if !rw.written {
 		rw.NoContent()
 	}
+	// Streamed responses that were never closed still need to be committed.
+	rw.commit()
 }
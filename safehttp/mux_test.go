@@ -16,10 +16,14 @@ package safehttp_test
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"text/template"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-safeweb/safehttp"
@@ -174,12 +178,24 @@ func (p setHeaderInterceptor) Before(w *safehttp.ResponseWriter, _ *safehttp.Inc
 	return safehttp.NotWritten()
 }
 
+func (p setHeaderInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (p setHeaderInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 type internalErrorInterceptor struct{}
 
 func (internalErrorInterceptor) Before(w *safehttp.ResponseWriter, _ *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
 	return w.WriteError(safehttp.StatusInternalServerError)
 }
 
+func (internalErrorInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (internalErrorInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 type claimHeaderInterceptor struct {
 	headerToClaim string
 }
@@ -192,6 +208,12 @@ func (p *claimHeaderInterceptor) Before(w *safehttp.ResponseWriter, r *safehttp.
 	return safehttp.NotWritten()
 }
 
+func (p *claimHeaderInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (p *claimHeaderInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 func claimInterceptorSetHeader(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, value string) {
 	f := r.Context().Value(claimCtxKey{}).(func([]string))
 	f([]string{value})
@@ -203,6 +225,12 @@ func (panickingInterceptor) Before(w *safehttp.ResponseWriter, _ *safehttp.Incom
 	panic("bad")
 }
 
+func (panickingInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (panickingInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 func TestMuxInterceptors(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -337,6 +365,12 @@ func (p setHeaderConfigInterceptor) Before(w *safehttp.ResponseWriter, _ *safeht
 	return safehttp.Result{}
 }
 
+func (p setHeaderConfigInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (p setHeaderConfigInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 type noInterceptorConfig struct{}
 
 func (noInterceptorConfig) Match(i safehttp.Interceptor) bool {
@@ -406,6 +440,12 @@ func (interceptorOne) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingReq
 	return safehttp.Result{}
 }
 
+func (interceptorOne) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (interceptorOne) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 type interceptorTwo struct {
 }
 
@@ -417,6 +457,12 @@ func (interceptorTwo) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingReq
 	return safehttp.Result{}
 }
 
+func (interceptorTwo) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (interceptorTwo) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 type interceptorThree struct {
 }
 
@@ -428,6 +474,12 @@ func (interceptorThree) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingR
 	return safehttp.Result{}
 }
 
+func (interceptorThree) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (interceptorThree) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
 func TestMuxDeterministicInterceptorOrder(t *testing.T) {
 	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
 	mux.Install(interceptorOne{})
@@ -485,3 +537,1085 @@ func TestMuxHandlerReturnsNotWritten(t *testing.T) {
 		t.Errorf(`response body got: %q want: ""`, got)
 	}
 }
+
+func TestMuxPathParams(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.Handle("/users/{id}/posts/{postID}", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		p := r.PathParams()
+		id := p.Int64("id", 0)
+		postID := p.String("postID", "")
+		if err := p.Err(); err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		return w.Write(safehtml.HTMLEscaped(fmt.Sprintf("user %d post %s", id, postID)))
+	}))
+	mux.Handle("/users/me/posts/{postID}", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("me post " + r.PathParams().String("postID", "")))
+	}))
+	mux.Handle("/users/", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("users subtree"))
+	}))
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("root"))
+	}))
+	mux.Handle("/files/{name}", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("file " + r.PathParams().String("name", "")))
+	}))
+
+	tests := []struct {
+		name       string
+		target     string
+		wantStatus safehttp.StatusCode
+		wantBody   string
+	}{
+		{
+			name:       "Parameters",
+			target:     "http://foo.com/users/42/posts/hello",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "user 42 post hello",
+		},
+		{
+			name:       "Invalid typed parameter",
+			target:     "http://foo.com/users/abc/posts/hello",
+			wantStatus: safehttp.StatusBadRequest,
+			wantBody:   "Bad Request\n",
+		},
+		{
+			name:       "Literal takes precedence",
+			target:     "http://foo.com/users/me/posts/hello",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "me post hello",
+		},
+		{
+			name:       "Fallback to subtree with same prefix",
+			target:     "http://foo.com/users/42/likes",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "users subtree",
+		},
+		{
+			name:       "Fallback to shorter subtree",
+			target:     "http://foo.com/files/a/b",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "root",
+		},
+		{
+			name:       "Escaped slash is not a segment separator",
+			target:     "http://foo.com/files/a%2Fb",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "root",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, tt.target, nil))
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMuxPathParamsNotFound(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.Handle("/users/{id}", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("user"))
+	}))
+
+	b := &strings.Builder{}
+	rw := newResponseRecorder(b)
+
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/users/42/posts", nil))
+
+	if want := safehttp.StatusNotFound; rw.status != want {
+		t.Errorf("rw.status: got %v want %v", rw.status, want)
+	}
+	if got, want := b.String(), "Not Found\n"; got != want {
+		t.Errorf("response body: got %q want %q", got, want)
+	}
+}
+
+func TestMuxPathParamsSubtreeParent(t *testing.T) {
+	tests := []struct {
+		name       string
+		patterns   []string
+		target     string
+		wantStatus safehttp.StatusCode
+		wantBody   string
+	}{
+		{
+			name:       "Parent of a nested parameter subtree",
+			patterns:   []string{"/a/{id}", "/a/b/{x}"},
+			target:     "http://foo.com/a/b",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "/a/{id} map[id:b]",
+		},
+		{
+			name:       "Nested parameter subtree",
+			patterns:   []string{"/a/{id}", "/a/b/{x}"},
+			target:     "http://foo.com/a/b/c",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "/a/b/{x} map[x:c]",
+		},
+		{
+			name:       "Nested parameter subtree root",
+			patterns:   []string{"/a/{id}", "/a/b/{x}"},
+			target:     "http://foo.com/a/b/",
+			wantStatus: safehttp.StatusNotFound,
+			wantBody:   "Not Found\n",
+		},
+		{
+			name:       "Parent of a parameter subtree is not redirected",
+			patterns:   []string{"/a/{id}"},
+			target:     "http://foo.com/a",
+			wantStatus: safehttp.StatusNotFound,
+			wantBody:   "Not Found\n",
+		},
+		{
+			name:       "Parent of a parameter subtree matched by another pattern",
+			patterns:   []string{"/a/{id}", "/{name}"},
+			target:     "http://foo.com/a",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "/{name} map[name:a]",
+		},
+		{
+			name:       "Parameter in a shorter subtree",
+			patterns:   []string{"/a/{id}", "/{org}/"},
+			target:     "http://foo.com/a/b/c",
+			wantStatus: safehttp.StatusOK,
+			wantBody:   "/{org}/ map[org:a]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+			for _, p := range tt.patterns {
+				p := p
+				mux.Handle(p, safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+					params := map[string]string{}
+					for _, name := range []string{"id", "x", "name", "org"} {
+						if v := r.PathParams().String(name, ""); v != "" {
+							params[name] = v
+						}
+					}
+					return w.Write(safehtml.HTMLEscaped(fmt.Sprintf("%s %v", p, params)))
+				}))
+			}
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, tt.target, nil))
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMuxPathParamsHostSubtree(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		target   string
+		wantBody string
+	}{
+		{
+			name:     "Host-specific subtree takes precedence",
+			patterns: []string{"foo.com/a/{id}", "/a/b/c/d/", "foo.com/"},
+			target:   "http://foo.com/a/b/c/d/e",
+			wantBody: "foo.com/",
+		},
+		{
+			name:     "Port is ignored",
+			patterns: []string{"foo.com/a/{id}", "foo.com/"},
+			target:   "http://foo.com:8080/a/b/c",
+			wantBody: "foo.com/",
+		},
+		{
+			name:     "Other host",
+			patterns: []string{"/a/{id}", "/a/", "bar.com/"},
+			target:   "http://foo.com/a/b/c",
+			wantBody: "/a/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := safehttp.NewServeMux(testDispatcher{}, "foo.com", "foo.com:8080")
+			for _, p := range tt.patterns {
+				p := p
+				mux.Handle(p, safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+					return w.Write(safehtml.HTMLEscaped(p))
+				}))
+			}
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, tt.target, nil))
+
+			if want := safehttp.StatusOK; rw.status != want {
+				t.Errorf("rw.status: got %v want %v", rw.status, want)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMuxPathParamsSubtreeParentRedirect(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	})
+	mux.Handle("/a/{id}", safehttp.MethodGet, h)
+	mux.Handle("/a/", safehttp.MethodGet, h)
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/a?q=1", nil))
+
+	if want := http.StatusMovedPermanently; rr.Code != want {
+		t.Errorf("rr.Code: got %v want %v", rr.Code, want)
+	}
+	if got, want := rr.Header().Get("Location"), "/a/?q=1"; got != want {
+		t.Errorf(`rr.Header().Get("Location"): got %q want %q`, got, want)
+	}
+}
+
+func TestMuxHandleConflictingPatterns(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	})
+	mux.Handle("/users/{id}", safehttp.MethodGet, h)
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf(`mux.Handle("/users/{name}", MethodGet, h) expected panic`)
+		}
+	}()
+
+	mux.Handle("/users/{name}", safehttp.MethodGet, h)
+}
+
+type stagesInterceptor struct {
+	name   string
+	stages *[]string
+	reject bool
+}
+
+func (it stagesInterceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	*it.stages = append(*it.stages, it.name+" Before")
+	if it.reject {
+		return w.WriteError(safehttp.StatusForbidden)
+	}
+	return safehttp.NotWritten()
+}
+
+func (it stagesInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+	*it.stages = append(*it.stages, fmt.Sprintf("%s Commit %d", it.name, w.Status()))
+	w.Header().Add("Committed-By", it.name)
+}
+
+func (it stagesInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+	*it.stages = append(*it.stages, fmt.Sprintf("%s After %d", it.name, w.Status()))
+}
+
+func TestMuxInterceptorStages(t *testing.T) {
+	tests := []struct {
+		name        string
+		reject      bool
+		handler     safehttp.Handler
+		wantStatus  safehttp.StatusCode
+		wantStages  []string
+		wantHeaders map[string][]string
+	}{
+		{
+			name: "Write",
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+			}),
+			wantStatus: safehttp.StatusOK,
+			wantStages: []string{
+				"one Before", "two Before", "handler",
+				"two Commit 200", "one Commit 200",
+				"two After 200", "one After 200",
+			},
+			wantHeaders: map[string][]string{"Committed-By": {"two", "one"}},
+		},
+		{
+			name: "WriteError",
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.WriteError(safehttp.StatusNotFound)
+			}),
+			wantStatus: safehttp.StatusNotFound,
+			wantStages: []string{
+				"one Before", "two Before", "handler",
+				"two Commit 404", "one Commit 404",
+				"two After 404", "one After 404",
+			},
+			wantHeaders: map[string][]string{
+				"Committed-By":           {"two", "one"},
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+		{
+			name: "NotWritten",
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return safehttp.NotWritten()
+			}),
+			wantStatus: safehttp.StatusNoContent,
+			wantStages: []string{
+				"one Before", "two Before", "handler",
+				"two Commit 204", "one Commit 204",
+				"two After 204", "one After 204",
+			},
+			wantHeaders: map[string][]string{"Committed-By": {"two", "one"}},
+		},
+		{
+			name: "Panic",
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				panic("bad")
+			}),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantStages: []string{
+				"one Before", "two Before", "handler",
+				"two Commit 500", "one Commit 500",
+				"two After 500", "one After 500",
+			},
+			wantHeaders: map[string][]string{
+				"Committed-By":           {"two", "one"},
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+		{
+			name:   "Interrupted by interceptor",
+			reject: true,
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+			}),
+			wantStatus: safehttp.StatusForbidden,
+			wantStages: []string{
+				"one Before",
+				"one Commit 403",
+				"one After 403",
+			},
+			wantHeaders: map[string][]string{
+				"Committed-By":           {"one"},
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stages []string
+			mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+			mux.Install(stagesInterceptor{name: "one", stages: &stages, reject: tt.reject})
+			mux.Install(stagesInterceptor{name: "two", stages: &stages})
+			mux.Handle("/bar", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				stages = append(stages, "handler")
+				return tt.handler.ServeHTTP(w, r)
+			}))
+
+			rw := newResponseRecorder(&strings.Builder{})
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/bar", nil))
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if diff := cmp.Diff(tt.wantStages, stages); diff != "" {
+				t.Errorf("stages mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantHeaders, map[string][]string(rw.header)); diff != "" {
+				t.Errorf("rw.header mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+type errorRenderingDispatcher struct {
+	testDispatcher
+}
+
+func (errorRenderingDispatcher) RenderError(r *safehttp.IncomingRequest, code safehttp.StatusCode) safehttp.Response {
+	if code == safehttp.StatusTeapot {
+		return nil
+	}
+	return safehtml.HTMLEscaped(fmt.Sprintf("<h1>%d %s %s</h1>", code, r.Method(), r.URL.Path()))
+}
+
+func TestMuxErrorRenderer(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus safehttp.StatusCode
+		wantHeader map[string][]string
+		wantBody   string
+	}{
+		{
+			name:       "Unknown path",
+			req:        httptest.NewRequest(safehttp.MethodGet, "http://foo.com/unknown", nil),
+			wantStatus: safehttp.StatusNotFound,
+			wantHeader: map[string][]string{},
+			wantBody:   "&lt;h1&gt;404 GET /unknown&lt;/h1&gt;",
+		},
+		{
+			name:       "Invalid host",
+			req:        httptest.NewRequest(safehttp.MethodGet, "http://bar.com/bar", nil),
+			wantStatus: safehttp.StatusNotFound,
+			wantHeader: map[string][]string{},
+			wantBody:   "&lt;h1&gt;404 GET /bar&lt;/h1&gt;",
+		},
+		{
+			name:       "Invalid method",
+			req:        httptest.NewRequest(safehttp.MethodPost, "http://foo.com/bar", nil),
+			wantStatus: safehttp.StatusMethodNotAllowed,
+			wantHeader: map[string][]string{},
+			wantBody:   "&lt;h1&gt;405 POST /bar&lt;/h1&gt;",
+		},
+		{
+			name:       "Path parameter mismatch",
+			req:        httptest.NewRequest(safehttp.MethodGet, "http://foo.com/users/42/likes", nil),
+			wantStatus: safehttp.StatusNotFound,
+			wantHeader: map[string][]string{},
+			wantBody:   "&lt;h1&gt;404 GET /users/42/likes&lt;/h1&gt;",
+		},
+		{
+			name:       "Handler panic",
+			req:        httptest.NewRequest(safehttp.MethodGet, "http://foo.com/panic", nil),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantHeader: map[string][]string{},
+			wantBody:   "&lt;h1&gt;500 GET /panic&lt;/h1&gt;",
+		},
+		{
+			name:       "Handler WriteError",
+			req:        httptest.NewRequest(safehttp.MethodGet, "http://foo.com/forbidden", nil),
+			wantStatus: safehttp.StatusForbidden,
+			wantHeader: map[string][]string{},
+			wantBody:   "&lt;h1&gt;403 GET /forbidden&lt;/h1&gt;",
+		},
+		{
+			name:       "No rendered error",
+			req:        httptest.NewRequest(safehttp.MethodGet, "http://foo.com/teapot", nil),
+			wantStatus: safehttp.StatusTeapot,
+			wantHeader: map[string][]string{
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+			wantBody: "I'm a teapot\n",
+		},
+	}
+
+	mux := safehttp.NewServeMux(errorRenderingDispatcher{}, "foo.com")
+	mux.Handle("/bar", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("bar"))
+	}))
+	mux.Handle("/users/{id}/posts", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("posts"))
+	}))
+	mux.Handle("/panic", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		panic("oh no")
+	}))
+	mux.Handle("/forbidden", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.WriteError(safehttp.StatusForbidden)
+	}))
+	mux.Handle("/teapot", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.WriteError(safehttp.StatusTeapot)
+	}))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+
+			mux.ServeHTTP(rw, tt.req)
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if diff := cmp.Diff(tt.wantHeader, map[string][]string(rw.header)); diff != "" {
+				t.Errorf("rw.header mismatch (-want +got):\n%s", diff)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+type failingDispatcher struct{}
+
+func (failingDispatcher) Write(rw http.ResponseWriter, resp safehttp.Response) error {
+	return errors.New("dispatcher failure")
+}
+
+func (failingDispatcher) ExecuteTemplate(rw http.ResponseWriter, t safehttp.Template, data interface{}) error {
+	return errors.New("dispatcher failure")
+}
+
+type panickingCommitInterceptor struct{}
+
+func (panickingCommitInterceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	return safehttp.NotWritten()
+}
+
+func (panickingCommitInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+	panic("bad")
+}
+
+func (panickingCommitInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func TestMuxErrorHook(t *testing.T) {
+	tests := []struct {
+		name       string
+		d          safehttp.Dispatcher
+		interceps  []safehttp.Interceptor
+		handler    safehttp.Handler
+		wantStatus safehttp.StatusCode
+		wantBody   string
+		wantErr    string
+	}{
+		{
+			name: "Write dispatcher failure",
+			d:    failingDispatcher{},
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+			}),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantBody:   "Internal Server Error\n",
+			wantErr:    "dispatcher failure",
+		},
+		{
+			name: "WriteTemplate dispatcher failure",
+			d:    failingDispatcher{},
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.WriteTemplate(template.Must(template.New("name").Parse("<h1>{{ . }}</h1>")), "Hello World!")
+			}),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantBody:   "Internal Server Error\n",
+			wantErr:    "dispatcher failure",
+		},
+		{
+			name: "Unsafe response type",
+			d:    safehttp.DefaultDispatcher{},
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write("<h1>Hello World!</h1>")
+			}),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantBody:   "Internal Server Error\n",
+			wantErr:    "string is not a safe response type",
+		},
+		{
+			name: "Handler panic",
+			d:    testDispatcher{},
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				panic("oh no")
+			}),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantBody:   "Internal Server Error\n",
+			wantErr:    "panic: oh no",
+		},
+		{
+			name:      "Commit panic",
+			d:         testDispatcher{},
+			interceps: []safehttp.Interceptor{panickingCommitInterceptor{}},
+			handler: safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+			}),
+			wantStatus: safehttp.StatusInternalServerError,
+			wantBody:   "Internal Server Error\n",
+			wantErr:    "panic: bad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := safehttp.NewServeMux(tt.d, "foo.com")
+			var (
+				gotReq  *safehttp.IncomingRequest
+				gotErrs []error
+			)
+			mux.SetErrorHook(func(r *safehttp.IncomingRequest, err error) {
+				gotReq = r
+				gotErrs = append(gotErrs, err)
+			})
+			for _, it := range tt.interceps {
+				mux.Install(it)
+			}
+			mux.Handle("/bar", safehttp.MethodGet, tt.handler)
+
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/bar", nil))
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+			if len(gotErrs) != 1 {
+				t.Fatalf("len(gotErrs) got: %d want: 1", len(gotErrs))
+			}
+			if got := gotErrs[0].Error(); !strings.HasPrefix(got, tt.wantErr) {
+				t.Errorf("gotErrs[0].Error() got: %q want prefix: %q", got, tt.wantErr)
+			}
+			if gotReq == nil {
+				t.Fatal("error hook request got: nil want: request")
+			}
+			if got, want := gotReq.URL.Path(), "/bar"; got != want {
+				t.Errorf("gotReq.URL.Path() got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestMuxErrorHookPanicStack(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	var gotErr error
+	mux.SetErrorHook(func(r *safehttp.IncomingRequest, err error) {
+		gotErr = err
+	})
+	mux.Handle("/bar", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		panic("oh no")
+	}))
+
+	mux.ServeHTTP(newResponseRecorder(&strings.Builder{}), httptest.NewRequest(safehttp.MethodGet, "http://foo.com/bar", nil))
+
+	var pe *safehttp.PanicError
+	if !errors.As(gotErr, &pe) {
+		t.Fatalf("errors.As(gotErr, &pe) got: false want: true, gotErr: %v", gotErr)
+	}
+	if got, want := pe.Value, "oh no"; got != want {
+		t.Errorf("pe.Value got: %v want: %v", got, want)
+	}
+	if got, want := string(pe.Stack), "TestMuxErrorHookPanicStack"; !strings.Contains(got, want) {
+		t.Errorf("pe.Stack got: %q want to contain: %q", got, want)
+	}
+}
+
+func TestMuxPanicAfterWriteAborts(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	var gotErr error
+	mux.SetErrorHook(func(r *safehttp.IncomingRequest, err error) {
+		gotErr = err
+	})
+	mux.Handle("/bar", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+		panic("oh no")
+	}))
+
+	b := &strings.Builder{}
+	rw := newResponseRecorder(b)
+	defer func() {
+		if r := recover(); r != http.ErrAbortHandler {
+			t.Errorf("recover() got: %v want: %v", r, http.ErrAbortHandler)
+		}
+		if gotErr == nil {
+			t.Error("gotErr got: nil want: error")
+		}
+		if rw.status != safehttp.StatusOK {
+			t.Errorf("rw.status: got %v want %v", rw.status, safehttp.StatusOK)
+		}
+	}()
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/bar", nil))
+}
+
+func TestMuxFormSpec(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		q, err := r.URL.Query()
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		return w.Write(safehtml.HTMLEscaped(q.String("q", "")))
+	})
+	mux.Handle("/strict", safehttp.MethodGet, h, safehttp.FormSpec{Single: []string{"q"}})
+	mux.Handle("/lax", safehttp.MethodGet, h)
+
+	tests := []struct {
+		target     string
+		wantStatus safehttp.StatusCode
+	}{
+		{target: "http://foo.com/strict?q=pizza", wantStatus: safehttp.StatusOK},
+		{target: "http://foo.com/strict?q=pizza&q=pasta", wantStatus: safehttp.StatusBadRequest},
+		{target: "http://foo.com/strict?q=pizza&debug=1", wantStatus: safehttp.StatusBadRequest},
+		{target: "http://foo.com/lax?q=pizza&q=pasta&debug=1", wantStatus: safehttp.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			rw := newResponseRecorder(&strings.Builder{})
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodGet, tt.target, nil))
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMuxMaxBodySize(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.SetMaxBodySize(10)
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		f, err := r.PostForm()
+		if errors.Is(err, safehttp.ErrBodyTooLarge) {
+			return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+		}
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		return w.Write(safehtml.HTMLEscaped(f.String("a", "")))
+	})
+	mux.Handle("/default", safehttp.MethodPost, h)
+	mux.Handle("/large", safehttp.MethodPost, h, safehttp.MaxBodySize(100))
+	mux.Handle("/unlimited", safehttp.MethodPost, h, safehttp.MaxBodySize(0))
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		chunked    bool
+		wantStatus safehttp.StatusCode
+	}{
+		{
+			name:       "At the limit",
+			path:       "/default",
+			body:       "a=12345678",
+			wantStatus: safehttp.StatusOK,
+		},
+		{
+			name:       "Content-Length over the limit",
+			path:       "/default",
+			body:       "a=123456789",
+			wantStatus: safehttp.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "Chunked body over the limit",
+			path:       "/default",
+			body:       "a=123456789",
+			chunked:    true,
+			wantStatus: safehttp.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "Route override",
+			path:       "/large",
+			body:       "a=" + strings.Repeat("x", 98),
+			wantStatus: safehttp.StatusOK,
+		},
+		{
+			name:       "Route override exceeded",
+			path:       "/large",
+			body:       "a=" + strings.Repeat("x", 99),
+			chunked:    true,
+			wantStatus: safehttp.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "Unlimited route",
+			path:       "/unlimited",
+			body:       "a=" + strings.Repeat("x", 1000),
+			wantStatus: safehttp.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com"+tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			rw := newResponseRecorder(&strings.Builder{})
+
+			mux.ServeHTTP(rw, req)
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestMuxMaxBodySizeSkipsHandler(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.SetMaxBodySize(10)
+	called := false
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		called = true
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	}))
+
+	rw := newResponseRecorder(&strings.Builder{})
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(strings.Repeat("x", 11))))
+
+	if want := safehttp.StatusRequestEntityTooLarge; rw.status != want {
+		t.Errorf("rw.status: got %v want %v", rw.status, want)
+	}
+	if called {
+		t.Error("handler called, want not called")
+	}
+}
+
+func TestMuxMaxBodySizeInterceptors(t *testing.T) {
+	var stages []string
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.SetMaxBodySize(10)
+	mux.Install(stagesInterceptor{name: "one", stages: &stages})
+	mux.Install(stagesInterceptor{name: "two", stages: &stages})
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		stages = append(stages, "handler")
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	}))
+
+	rw := newResponseRecorder(&strings.Builder{})
+	mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(strings.Repeat("x", 11))))
+
+	if want := safehttp.StatusRequestEntityTooLarge; rw.status != want {
+		t.Errorf("rw.status: got %v want %v", rw.status, want)
+	}
+	wantStages := []string{
+		"one Before", "two Before",
+		"two Commit 413", "one Commit 413",
+		"two After 413", "one After 413",
+	}
+	if diff := cmp.Diff(wantStages, stages); diff != "" {
+		t.Errorf("stages mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"two", "one"}, rw.header.Values("Committed-By")); diff != "" {
+		t.Errorf("rw.header.Values(\"Committed-By\") mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMuxMaxBodySizeDecodeJSON(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.SetMaxBodySize(10)
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		var v map[string]string
+		err := r.DecodeJSON(&v)
+		var re *safehttp.RequestError
+		if errors.As(err, &re) {
+			return w.WriteError(re.Code)
+		}
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	}))
+
+	req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(`{"a": "1234567890"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rw := newResponseRecorder(&strings.Builder{})
+
+	mux.ServeHTTP(rw, req)
+
+	if want := safehttp.StatusRequestEntityTooLarge; rw.status != want {
+		t.Errorf("rw.status: got %v want %v", rw.status, want)
+	}
+}
+
+func TestMuxMaxBodySizeDecodeJSONRouteOverride(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		var v map[string]string
+		err := r.DecodeJSON(&v)
+		var re *safehttp.RequestError
+		if errors.As(err, &re) {
+			return w.WriteError(re.Code)
+		}
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	}), safehttp.MaxBodySize(2*safehttp.DefaultMaxBodySize))
+
+	body := `{"a": "` + strings.Repeat("a", safehttp.DefaultMaxBodySize) + `"}`
+	req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rw := newResponseRecorder(&strings.Builder{})
+
+	mux.ServeHTTP(rw, req)
+
+	if want := safehttp.StatusOK; rw.status != want {
+		t.Errorf("rw.status: got %v want %v", rw.status, want)
+	}
+}
+
+func TestMuxRemovesMultipartFiles(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	var fh *multipart.FileHeader
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		// With no memory available, files are stored on disk.
+		f, err := r.MultipartForm(0)
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		fh = f.File("file")[0]
+		return w.Write(safehtml.HTMLEscaped("uploaded"))
+	}))
+
+	body := "--123\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"myfile\"\r\n" +
+		"\r\n" +
+		"file content\r\n" +
+		"--123--\r\n"
+	req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", `multipart/form-data; boundary="123"`)
+	rw := newResponseRecorder(&strings.Builder{})
+
+	mux.ServeHTTP(rw, req)
+
+	if want := safehttp.StatusOK; rw.status != want {
+		t.Fatalf("rw.status: got %v want %v", rw.status, want)
+	}
+	if f, err := fh.Open(); err == nil {
+		f.Close()
+		t.Error("fh.Open() got: nil want: error")
+	}
+}
+
+type setContextInterceptor struct{}
+
+func (setContextInterceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	r.SetContext(context.WithValue(r.Context(), setContextKey{}, "value"))
+	return safehttp.NotWritten()
+}
+
+func (setContextInterceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+func (setContextInterceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+type setContextKey struct{}
+
+func TestMuxRemovesMultipartFilesAfterSetContext(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.Install(setContextInterceptor{})
+	var fh *multipart.FileHeader
+	mux.Handle("/", safehttp.MethodPost, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		f, err := r.MultipartForm(1)
+		if err != nil {
+			return w.WriteError(safehttp.StatusBadRequest)
+		}
+		fh = f.File("file")[0]
+		return w.Write(safehtml.HTMLEscaped("uploaded"))
+	}))
+
+	body := "--123\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"myfile\"\r\n" +
+		"\r\n" +
+		"file content\r\n" +
+		"--123--\r\n"
+	req := httptest.NewRequest(safehttp.MethodPost, "http://foo.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", `multipart/form-data; boundary="123"`)
+	rw := newResponseRecorder(&strings.Builder{})
+
+	mux.ServeHTTP(rw, req)
+
+	if want := safehttp.StatusOK; rw.status != want {
+		t.Fatalf("rw.status: got %v want %v", rw.status, want)
+	}
+	if f, err := fh.Open(); err == nil {
+		f.Close()
+		t.Error("fh.Open() got: nil want: error")
+	}
+}
+
+func TestMuxRoutes(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("hello"))
+	})
+	mux.Handle("/users/{id}", safehttp.MethodPost, h, safehttp.MaxBodySize(100))
+	mux.Handle("/users/{id}", safehttp.MethodGet, h)
+	mux.Handle("/", safehttp.MethodGet, h)
+
+	want := []safehttp.Route{
+		{Pattern: "/", Method: safehttp.MethodGet},
+		{Pattern: "/users/{id}", Method: safehttp.MethodGet},
+		{Pattern: "/users/{id}", Method: safehttp.MethodPost, Configs: []safehttp.Config{safehttp.MaxBodySize(100)}},
+	}
+	if diff := cmp.Diff(want, mux.Routes()); diff != "" {
+		t.Errorf("mux.Routes() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+type optionsConfig struct {
+	err error
+}
+
+func (optionsConfig) Match(safehttp.Interceptor) bool {
+	return false
+}
+
+func (optionsConfig) HandleOptions() bool {
+	return true
+}
+
+func (c optionsConfig) Validate() error {
+	return c.err
+}
+
+func TestMuxOptionsConfig(t *testing.T) {
+	h := func(body string) safehttp.Handler {
+		return safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+			return w.Write(safehtml.HTMLEscaped(body))
+		})
+	}
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.Handle("/implicit", safehttp.MethodGet, h("get"), optionsConfig{})
+	mux.Handle("/explicit", safehttp.MethodGet, h("get"), optionsConfig{})
+	mux.Handle("/explicit", safehttp.MethodOptions, h("options"))
+	mux.Handle("/none", safehttp.MethodGet, h("get"))
+
+	tests := []struct {
+		path       string
+		wantStatus safehttp.StatusCode
+		wantBody   string
+	}{
+		{path: "/implicit", wantStatus: safehttp.StatusMethodNotAllowed, wantBody: "Method Not Allowed\n"},
+		{path: "/explicit", wantStatus: safehttp.StatusOK, wantBody: "options"},
+		{path: "/none", wantStatus: safehttp.StatusMethodNotAllowed, wantBody: "Method Not Allowed\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+
+			mux.ServeHTTP(rw, httptest.NewRequest(safehttp.MethodOptions, "http://foo.com"+tt.path, nil))
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestMuxHandleInvalidConfig(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	})
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error(`mux.Handle("/", MethodGet, h, invalidConfig) expected panic`)
+		}
+	}()
+	mux.Handle("/", safehttp.MethodGet, h, optionsConfig{err: errors.New("invalid")})
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AcceptedMediaType returns the media type among offers, e.g. "text/html" or
+// "application/json", that best matches the Accept header of the request,
+// taking quality values into account. When several offers are equally
+// acceptable, the first one is returned. If the request has no Accept header,
+// the first offer is returned. If none of the offers is acceptable, the empty
+// string is returned.
+func (r *IncomingRequest) AcceptedMediaType(offers ...string) string {
+	return negotiate(r.req.Header.Values("Accept"), offers, matchMediaType)
+}
+
+// AcceptedLanguage returns the language tag among offers, e.g. "en-US", that
+// best matches the Accept-Language header of the request, taking quality
+// values into account. A language range matches the tags it's a prefix of,
+// so that "en" matches "en-US", and, with a lower precedence, the tags that
+// are a prefix of it.
+//
+// When several offers are equally acceptable, the first one is returned. If
+// the request has no Accept-Language header or if none of the offers is
+// acceptable, the first offer is returned, since responding in another
+// language is better than not responding at all.
+func (r *IncomingRequest) AcceptedLanguage(offers ...string) string {
+	if lang := negotiate(r.req.Header.Values("Accept-Language"), offers, matchLanguage); lang != "" {
+		return lang
+	}
+	if len(offers) == 0 {
+		return ""
+	}
+	return offers[0]
+}
+
+// Negotiate returns the media type among offers that best matches the Accept
+// header of the request, as done by IncomingRequest.AcceptedMediaType. If none
+// of the offers is acceptable, it responds with a 406 Not Acceptable error and
+// returns the empty string together with the Result, which should be returned
+// by the handler:
+//
+//	mt, res := w.Negotiate(r, "text/html", "application/json")
+//	if mt == "" {
+//		return res
+//	}
+func (w *ResponseWriter) Negotiate(r *IncomingRequest, offers ...string) (string, Result) {
+	if mt := r.AcceptedMediaType(offers...); mt != "" {
+		return mt, NotWritten()
+	}
+	return "", w.WriteError(StatusNotAcceptable)
+}
+
+// acceptRange is a range of an Accept or Accept-Language header with its
+// quality value.
+type acceptRange struct {
+	value string
+	q     float64
+}
+
+// parseAccept parses the comma-separated ranges of the values of an Accept
+// or Accept-Language header. Ranges with an invalid quality value are
+// ignored.
+func parseAccept(values []string) []acceptRange {
+	var ranges []acceptRange
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			params := strings.Split(s, ";")
+			rng := acceptRange{value: strings.ToLower(strings.TrimSpace(params[0])), q: 1}
+			if rng.value == "" {
+				continue
+			}
+			valid := true
+			for _, p := range params[1:] {
+				name, val := p, ""
+				if i := strings.Index(p, "="); i >= 0 {
+					name, val = p[:i], p[i+1:]
+				}
+				if strings.ToLower(strings.TrimSpace(name)) != "q" {
+					continue
+				}
+				q, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+				if err != nil || q < 0 || q > 1 {
+					valid = false
+					break
+				}
+				rng.q = q
+			}
+			if valid {
+				ranges = append(ranges, rng)
+			}
+		}
+	}
+	return ranges
+}
+
+// negotiate returns the offer with the highest quality value according to the
+// given header values, or the empty string if none is acceptable. The quality
+// value of an offer is the one of the matching range with the highest
+// specificity, as returned by match. A specificity of zero means that the
+// range doesn't match.
+func negotiate(values []string, offers []string, match func(rng, offer string) int) string {
+	if len(values) == 0 {
+		if len(offers) == 0 {
+			return ""
+		}
+		return offers[0]
+	}
+	ranges := parseAccept(values)
+
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, o := range offers {
+		lo := strings.ToLower(o)
+		q, spec := 0.0, 0
+		for _, rng := range ranges {
+			if s := match(rng.value, lo); s > spec {
+				q, spec = rng.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = o, q
+		}
+	}
+	return best
+}
+
+// matchMediaType matches a media range, e.g. "text/*", against a media type.
+// Parameters of the media range other than the quality value are ignored.
+func matchMediaType(rng, mt string) int {
+	switch {
+	case rng == mt:
+		return 3
+	case rng == "*/*":
+		return 1
+	case strings.HasSuffix(rng, "/*") && strings.HasPrefix(mt, rng[:len(rng)-1]):
+		return 2
+	}
+	return 0
+}
+
+// matchLanguage matches a language range, e.g. "en", against a language tag.
+func matchLanguage(rng, tag string) int {
+	switch {
+	case rng == tag:
+		return 4
+	case strings.HasPrefix(tag, rng+"-"):
+		return 3
+	case strings.HasPrefix(rng, tag+"-"):
+		return 2
+	case rng == "*":
+		return 1
+	}
+	return 0
+}
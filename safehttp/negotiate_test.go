@@ -0,0 +1,204 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+	"github.com/google/safehtml"
+)
+
+func TestIncomingRequestAcceptedMediaType(t *testing.T) {
+	offers := []string{"text/html", "application/json"}
+	tests := []struct {
+		name   string
+		accept []string
+		want   string
+	}{
+		{
+			name: "No Accept header",
+			want: "text/html",
+		},
+		{
+			name:   "Exact match",
+			accept: []string{"application/json"},
+			want:   "application/json",
+		},
+		{
+			name:   "Case insensitive",
+			accept: []string{"Application/JSON"},
+			want:   "application/json",
+		},
+		{
+			name:   "Quality values",
+			accept: []string{"text/html;q=0.5, application/json"},
+			want:   "application/json",
+		},
+		{
+			name:   "Multiple headers",
+			accept: []string{"text/html;q=0.5", "application/json;q=0.8"},
+			want:   "application/json",
+		},
+		{
+			name:   "Wildcard",
+			accept: []string{"*/*"},
+			want:   "text/html",
+		},
+		{
+			name:   "Subtype wildcard",
+			accept: []string{"application/*, text/html;q=0.1"},
+			want:   "application/json",
+		},
+		{
+			name:   "More specific range takes precedence",
+			accept: []string{"text/*;q=0.9, text/html;q=0.1, application/json;q=0.5"},
+			want:   "application/json",
+		},
+		{
+			name:   "Browser",
+			accept: []string{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"},
+			want:   "text/html",
+		},
+		{
+			name:   "Excluded with zero quality",
+			accept: []string{"*/*, text/html;q=0"},
+			want:   "application/json",
+		},
+		{
+			name:   "Invalid quality ignored",
+			accept: []string{"application/json;q=2, text/html;q=0.1"},
+			want:   "text/html",
+		},
+		{
+			name:   "No match",
+			accept: []string{"image/png"},
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+			for _, a := range tt.accept {
+				r.Header.Add("Accept", a)
+			}
+			if got := r.AcceptedMediaType(offers...); got != tt.want {
+				t.Errorf("r.AcceptedMediaType(offers...) got: %q want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIncomingRequestAcceptedLanguage(t *testing.T) {
+	offers := []string{"en-US", "fr", "de-DE"}
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{
+			name: "No Accept-Language header",
+			want: "en-US",
+		},
+		{
+			name:   "Exact match",
+			accept: "fr",
+			want:   "fr",
+		},
+		{
+			name:   "Prefix range",
+			accept: "de",
+			want:   "de-DE",
+		},
+		{
+			name:   "More specific tag than offered",
+			accept: "fr-CA",
+			want:   "fr",
+		},
+		{
+			name:   "Quality values",
+			accept: "de-DE;q=0.8, fr;q=0.9, en;q=0.1",
+			want:   "fr",
+		},
+		{
+			name:   "Case insensitive",
+			accept: "DE-de",
+			want:   "de-DE",
+		},
+		{
+			name:   "Wildcard with exclusion",
+			accept: "*, en;q=0",
+			want:   "fr",
+		},
+		{
+			name:   "No match falls back to first offer",
+			accept: "ja",
+			want:   "en-US",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept-Language", tt.accept)
+			}
+			if got := r.AcceptedLanguage(offers...); got != tt.want {
+				t.Errorf("r.AcceptedLanguage(offers...) got: %q want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMuxNegotiate(t *testing.T) {
+	mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		mt, res := w.Negotiate(r, "text/html", "application/json")
+		if mt == "" {
+			return res
+		}
+		return w.Write(safehtml.HTMLEscaped(mt))
+	}))
+
+	tests := []struct {
+		accept     string
+		wantStatus safehttp.StatusCode
+		wantBody   string
+	}{
+		{accept: "application/json", wantStatus: safehttp.StatusOK, wantBody: "application/json"},
+		{accept: "image/png", wantStatus: safehttp.StatusNotAcceptable, wantBody: "Not Acceptable\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/", nil)
+			req.Header.Set("Accept", tt.accept)
+			b := &strings.Builder{}
+			rw := newResponseRecorder(b)
+
+			mux.ServeHTTP(rw, req)
+
+			if rw.status != tt.wantStatus {
+				t.Errorf("rw.status: got %v want %v", rw.status, tt.wantStatus)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body: got %q want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
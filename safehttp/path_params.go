@@ -0,0 +1,78 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"strconv"
+)
+
+// PathParams contains the values of the parameters of the pattern a handler
+// was registered with, e.g. the value of {id} for the pattern "/users/{id}".
+//
+// Each value is a single, non-empty path segment. It never contains a slash
+// and is never . or ..
+type PathParams struct {
+	values map[string]string
+	err    error
+}
+
+// Int64 returns the value of the path parameter. If the value is not a valid
+// int64, the defaultValue is returned instead and an error is set
+// (retrievable by Err()).
+func (p *PathParams) Int64(param string, defaultValue int64) int64 {
+	val, ok := p.values[param]
+	if !ok {
+		return defaultValue
+	}
+	paramVal, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		p.err = err
+		return defaultValue
+	}
+	return paramVal
+}
+
+// Uint64 returns the value of the path parameter. If the value is not a valid
+// uint64, the defaultValue is returned instead and an error is set
+// (retrievable by Err()).
+func (p *PathParams) Uint64(param string, defaultValue uint64) uint64 {
+	val, ok := p.values[param]
+	if !ok {
+		return defaultValue
+	}
+	paramVal, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		p.err = err
+		return defaultValue
+	}
+	return paramVal
+}
+
+// String returns the value of the path parameter. If the pattern has no such
+// parameter, the defaultValue is returned instead.
+func (p *PathParams) String(param string, defaultValue string) string {
+	val, ok := p.values[param]
+	if !ok {
+		return defaultValue
+	}
+	return val
+}
+
+// Err returns nil unless an error occurred while accessing a path parameter.
+// Calling this method will return the last error that occurred while parsing
+// path parameters.
+func (p *PathParams) Err() error {
+	return p.err
+}
@@ -0,0 +1,183 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// pathPattern is a parsed ServeMux pattern.
+type pathPattern struct {
+	// host is the optional host name the pattern is restricted to.
+	host string
+	// segments are the slash-separated segments of the pattern path.
+	segments []patternSegment
+	// subtree reports whether the pattern ends in a slash and thus also
+	// matches all the paths below it.
+	subtree bool
+}
+
+// patternSegment is either a literal path segment or a parameter, written as
+// {name} in the pattern.
+type patternSegment struct {
+	literal string
+	param   string
+}
+
+func parsePattern(pattern string) (pathPattern, error) {
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return pathPattern{}, fmt.Errorf("invalid pattern %q: missing path", pattern)
+	}
+	p := pathPattern{host: pattern[:i]}
+	path := pattern[i+1:]
+	if path == "" {
+		p.subtree = true
+		return p, nil
+	}
+	if strings.HasSuffix(path, "/") {
+		p.subtree = true
+		path = path[:len(path)-1]
+	}
+
+	seen := map[string]bool{}
+	for _, s := range strings.Split(path, "/") {
+		if s == "" {
+			return pathPattern{}, fmt.Errorf("invalid pattern %q: empty path segment", pattern)
+		}
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			if strings.ContainsAny(s, "{}") {
+				return pathPattern{}, fmt.Errorf("invalid pattern %q: parameters must span a whole path segment", pattern)
+			}
+			p.segments = append(p.segments, patternSegment{literal: s})
+			continue
+		}
+		name := s[1 : len(s)-1]
+		if err := validParamName(name); err != nil {
+			return pathPattern{}, fmt.Errorf("invalid pattern %q: %v", pattern, err)
+		}
+		if seen[name] {
+			return pathPattern{}, fmt.Errorf("invalid pattern %q: duplicate parameter %q", pattern, name)
+		}
+		seen[name] = true
+		p.segments = append(p.segments, patternSegment{param: name})
+	}
+	return p, nil
+}
+
+func validParamName(name string) error {
+	if name == "" {
+		return errors.New("empty parameter name")
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return fmt.Errorf("invalid character %q in parameter name %q", c, name)
+		}
+	}
+	return nil
+}
+
+// hasParams reports whether the pattern contains at least one parameter.
+func (p pathPattern) hasParams() bool {
+	for _, s := range p.segments {
+		if s.param != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// muxPattern returns the pattern used to register p in the underlying
+// http.ServeMux. For patterns with parameters, this is the rooted subtree made
+// of the literal segments preceding the first parameter.
+func (p pathPattern) muxPattern() string {
+	var b strings.Builder
+	b.WriteString(p.host)
+	for _, s := range p.segments {
+		if s.param != "" {
+			b.WriteByte('/')
+			return b.String()
+		}
+		b.WriteByte('/')
+		b.WriteString(s.literal)
+	}
+	if p.subtree {
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+// match matches the path against the pattern and returns the values of its
+// parameters. The path must already be cleaned, as done by http.ServeMux.
+//
+// Parameters only match a single, non-empty path segment and never match the
+// . and .. elements.
+func (p pathPattern) match(path string) (map[string]string, bool) {
+	if !strings.HasPrefix(path, "/") {
+		return nil, false
+	}
+	segs := strings.Split(path[1:], "/")
+	if p.subtree && len(segs) <= len(p.segments) || !p.subtree && len(segs) != len(p.segments) {
+		return nil, false
+	}
+
+	params := map[string]string{}
+	for i, s := range p.segments {
+		if s.param == "" {
+			if segs[i] != s.literal {
+				return nil, false
+			}
+			continue
+		}
+		if v := segs[i]; v == "" || v == "." || v == ".." {
+			return nil, false
+		}
+		params[s.param] = segs[i]
+	}
+	return params, true
+}
+
+// moreSpecific reports whether p takes precedence over q when both match the
+// same path. At the first segment where they differ, a literal takes precedence
+// over a parameter. Otherwise, longer patterns take precedence over shorter ones
+// and a fixed path takes precedence over a subtree.
+func (p pathPattern) moreSpecific(q pathPattern) bool {
+	for i := 0; i < len(p.segments) && i < len(q.segments); i++ {
+		pLit, qLit := p.segments[i].param == "", q.segments[i].param == ""
+		if pLit != qLit {
+			return pLit
+		}
+	}
+	if len(p.segments) != len(q.segments) {
+		return len(p.segments) > len(q.segments)
+	}
+	return !p.subtree && q.subtree
+}
+
+// conflicts reports whether p and q match exactly the same set of paths.
+func (p pathPattern) conflicts(q pathPattern) bool {
+	if p.host != q.host || p.subtree != q.subtree || len(p.segments) != len(q.segments) {
+		return false
+	}
+	for i, s := range p.segments {
+		t := q.segments[i]
+		if (s.param == "") != (t.param == "") || s.literal != t.literal {
+			return false
+		}
+	}
+	return true
+}
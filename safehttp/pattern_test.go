@@ -0,0 +1,195 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParsePatternMuxPattern(t *testing.T) {
+	tests := []struct {
+		pattern        string
+		wantMuxPattern string
+		wantHasParams  bool
+	}{
+		{pattern: "/", wantMuxPattern: "/"},
+		{pattern: "/users", wantMuxPattern: "/users"},
+		{pattern: "/users/", wantMuxPattern: "/users/"},
+		{pattern: "foo.com/users", wantMuxPattern: "foo.com/users"},
+		{pattern: "/{id}", wantMuxPattern: "/", wantHasParams: true},
+		{pattern: "/users/{id}", wantMuxPattern: "/users/", wantHasParams: true},
+		{pattern: "/users/{id}/posts/{postID}", wantMuxPattern: "/users/", wantHasParams: true},
+		{pattern: "/users/{id}/posts/", wantMuxPattern: "/users/", wantHasParams: true},
+		{pattern: "foo.com/api/v1/{resource}", wantMuxPattern: "foo.com/api/v1/", wantHasParams: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			p, err := parsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("parsePattern(%q) got err: %v want: nil", tt.pattern, err)
+			}
+			if got := p.muxPattern(); got != tt.wantMuxPattern {
+				t.Errorf("p.muxPattern() got: %q want: %q", got, tt.wantMuxPattern)
+			}
+			if got := p.hasParams(); got != tt.wantHasParams {
+				t.Errorf("p.hasParams() got: %v want: %v", got, tt.wantHasParams)
+			}
+		})
+	}
+}
+
+func TestParsePatternInvalid(t *testing.T) {
+	tests := []string{
+		"foo.com",
+		"/users//posts",
+		"/users/{}",
+		"/users/{id",
+		"/users/id}",
+		"/users/x{id}",
+		"/users/{i-d}",
+		"/users/{id}/posts/{id}",
+	}
+
+	for _, pattern := range tests {
+		t.Run(pattern, func(t *testing.T) {
+			if _, err := parsePattern(pattern); err == nil {
+				t.Errorf("parsePattern(%q) got: nil want: error", pattern)
+			}
+		})
+	}
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    string
+		path       string
+		wantParams map[string]string
+		wantMatch  bool
+	}{
+		{
+			name:       "Single parameter",
+			pattern:    "/users/{id}",
+			path:       "/users/42",
+			wantParams: map[string]string{"id": "42"},
+			wantMatch:  true,
+		},
+		{
+			name:       "Multiple parameters",
+			pattern:    "/users/{id}/posts/{postID}",
+			path:       "/users/42/posts/abc",
+			wantParams: map[string]string{"id": "42", "postID": "abc"},
+			wantMatch:  true,
+		},
+		{
+			name:       "Subtree",
+			pattern:    "/files/{id}/",
+			path:       "/files/42/a/b",
+			wantParams: map[string]string{"id": "42"},
+			wantMatch:  true,
+		},
+		{
+			name:       "Subtree root",
+			pattern:    "/files/{id}/",
+			path:       "/files/42/",
+			wantParams: map[string]string{"id": "42"},
+			wantMatch:  true,
+		},
+		{
+			name:    "Subtree without trailing slash",
+			pattern: "/files/{id}/",
+			path:    "/files/42",
+		},
+		{
+			name:    "Too many segments",
+			pattern: "/users/{id}",
+			path:    "/users/42/posts",
+		},
+		{
+			name:    "Too few segments",
+			pattern: "/users/{id}/posts",
+			path:    "/users/42",
+		},
+		{
+			name:    "Literal mismatch",
+			pattern: "/users/{id}/posts",
+			path:    "/users/42/likes",
+		},
+		{
+			name:    "Empty parameter",
+			pattern: "/users/{id}",
+			path:    "/users/",
+		},
+		{
+			name:    "Dot dot parameter",
+			pattern: "/users/{id}",
+			path:    "/users/..",
+		},
+		{
+			name:    "Dot parameter",
+			pattern: "/users/{id}",
+			path:    "/users/.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parsePattern(tt.pattern)
+			if err != nil {
+				t.Fatalf("parsePattern(%q) got err: %v want: nil", tt.pattern, err)
+			}
+			params, ok := p.match(tt.path)
+			if ok != tt.wantMatch {
+				t.Fatalf("p.match(%q) got: %v want: %v", tt.path, ok, tt.wantMatch)
+			}
+			if diff := cmp.Diff(tt.wantParams, params); diff != "" {
+				t.Errorf("p.match(%q) params mismatch (-want +got):\n%s", tt.path, diff)
+			}
+		})
+	}
+}
+
+func TestPatternMoreSpecific(t *testing.T) {
+	tests := []struct {
+		p, q string
+		want bool
+	}{
+		{p: "/users/me", q: "/users/{id}", want: true},
+		{p: "/users/{id}", q: "/users/me", want: false},
+		{p: "/users/{id}/posts", q: "/users/{id}/{tab}", want: true},
+		{p: "/users/{id}/{tab}", q: "/users/{id}/", want: true},
+		{p: "/users/{id}/", q: "/users/{id}/{tab}", want: false},
+		{p: "/users/{id}", q: "/users/{id}/", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.p+" "+tt.q, func(t *testing.T) {
+			p, err := parsePattern(tt.p)
+			if err != nil {
+				t.Fatalf("parsePattern(%q) got err: %v want: nil", tt.p, err)
+			}
+			q, err := parsePattern(tt.q)
+			if err != nil {
+				t.Fatalf("parsePattern(%q) got err: %v want: nil", tt.q, err)
+			}
+			if got := p.moreSpecific(q); got != tt.want {
+				t.Errorf("p.moreSpecific(q) got: %v want: %v", got, tt.want)
+			}
+		})
+	}
+}
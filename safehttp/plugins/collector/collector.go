@@ -17,6 +17,7 @@ package collector
 import (
 	"encoding/json"
 	"io/ioutil"
+	"strings"
 
 	"github.com/google/go-safeweb/safehttp"
 )
@@ -36,9 +37,10 @@ type Report struct {
 	// which the report was generated.
 	UserAgent string
 	// Body contains the body of the report. This will be different for every Type.
-	// If Type is csp-violation then Body will be a CSPReport. Otherwise Body will
-	// be a map[string]interface{} containing the object that was passed, as unmarshalled
-	// using encoding/json.
+	// If Type is csp-violation then Body will be a CSPReport, if Type is coop then
+	// Body will be a COOPReport and if Type is coep then Body will be a
+	// COEPReport. Otherwise Body will be a map[string]interface{} containing the
+	// object that was passed, as unmarshalled using encoding/json.
 	Body interface{}
 }
 
@@ -80,6 +82,124 @@ type CSPReport struct {
 	ColumnNumber uint
 }
 
+// TrustedTypesReport represents a Trusted Types violation, reported as a CSP
+// violation. See https://w3c.github.io/webappsec-trusted-types/dist/spec/#should-block-sink-type-mismatch
+// and https://w3c.github.io/webappsec-trusted-types/dist/spec/#should-block-create-policy
+type TrustedTypesReport struct {
+	// Type is either "trusted-types-sink", if a string was passed to an
+	// injection sink requiring Trusted Types, or "trusted-types-policy", if
+	// the creation of a policy was blocked.
+	Type string
+	// Sink is the injection sink the string was passed to, e.g.
+	// "Element innerHTML". It is empty for policy violations.
+	Sink string
+	// Policy is the name of the policy whose creation was blocked. It is
+	// empty for sink violations.
+	Policy string
+	// Sample is the beginning of the string passed to the injection sink. It
+	// is empty for policy violations.
+	Sample string
+	// Disposition is either "enforce" or "report" depending on whether the
+	// Trusted Types policy is enforced or report-only.
+	Disposition string
+	// DocumentURL is the URL of the document in which the violation occurred.
+	DocumentURL string
+	// SourceFile represents the URL of the document or worker in which the
+	// violation was found.
+	SourceFile string
+	// LineNumber is the line number in the document or worker at which the
+	// violation occurred.
+	LineNumber uint
+	// ColumnNumber is the column number in the document or worker at which the
+	// violation occurred.
+	ColumnNumber uint
+}
+
+// TrustedTypes returns the Trusted Types violation reported by r. If r isn't
+// a Trusted Types violation, ok is false.
+func (r CSPReport) TrustedTypes() (tr TrustedTypesReport, ok bool) {
+	typ := r.BlockedURL
+	switch {
+	case typ == "trusted-types-sink" || typ == "trusted-types-policy":
+	case r.EffectiveDirective == "require-trusted-types-for":
+		typ = "trusted-types-sink"
+	case r.EffectiveDirective == "trusted-types":
+		typ = "trusted-types-policy"
+	default:
+		return TrustedTypesReport{}, false
+	}
+
+	tr = TrustedTypesReport{
+		Type:         typ,
+		Disposition:  r.Disposition,
+		DocumentURL:  r.DocumentURL,
+		SourceFile:   r.SourceFile,
+		LineNumber:   r.LineNumber,
+		ColumnNumber: r.ColumnNumber,
+	}
+	if typ == "trusted-types-policy" {
+		tr.Policy = r.Sample
+		return tr, true
+	}
+	// The sample of sink violations has the form "Element innerHTML|<img src=x".
+	tr.Sink = r.Sample
+	if i := strings.Index(r.Sample, "|"); i >= 0 {
+		tr.Sink, tr.Sample = r.Sample[:i], r.Sample[i+1:]
+	}
+	return tr, true
+}
+
+// COOPReport represents a Cross-Origin-Opener-Policy violation report as
+// specified by https://html.spec.whatwg.org/multipage/origin.html#coop-violation-report
+type COOPReport struct {
+	// Disposition is either "enforce" or "reporting" depending on whether the
+	// Cross-Origin-Opener-Policy header or the
+	// Cross-Origin-Opener-Policy-Report-Only header is used.
+	Disposition string
+	// EffectivePolicy is the policy of the document that caused the violation.
+	EffectivePolicy string
+	// ViolationType is the type of the violation, e.g.
+	// "navigation-to-response" or "access-from-coop-page-to-opener".
+	ViolationType string
+	// PreviousResponseURL is the URL of the document navigated away from, for
+	// navigation violations.
+	PreviousResponseURL string
+	// NextResponseURL is the URL of the document navigated to, for navigation
+	// violations.
+	NextResponseURL string
+	// Referrer is the referrer of the navigation.
+	Referrer string
+	// Property is the name of the property of the window that was accessed,
+	// for access violations.
+	Property string
+	// SourceFile represents the URL of the script that accessed the window,
+	// for access violations.
+	SourceFile string
+	// LineNumber is the line number in the script at which the window was
+	// accessed.
+	LineNumber uint
+	// ColumnNumber is the column number in the script at which the window was
+	// accessed.
+	ColumnNumber uint
+}
+
+// COEPReport represents a Cross-Origin-Embedder-Policy violation report as
+// specified by https://html.spec.whatwg.org/multipage/origin.html#coep-report-type
+type COEPReport struct {
+	// Disposition is either "enforce" or "reporting" depending on whether the
+	// Cross-Origin-Embedder-Policy header or the
+	// Cross-Origin-Embedder-Policy-Report-Only header is used.
+	Disposition string
+	// ViolationType is the type of the violation, either "corp",
+	// "navigation" or "worker initialization".
+	ViolationType string
+	// BlockedURL is the URL of the resource that was blocked.
+	BlockedURL string
+	// Destination is the request destination of the blocked resource, e.g.
+	// "image" or "iframe".
+	Destination string
+}
+
 // Handler builds a safehttp.Handler which calls the given handler or cspHandler when
 // a violation report is received. Make sure to register the handler to receive POST
 // requests. If the handler recieves anything other than POST requests it will
@@ -181,6 +301,8 @@ func handleDeprecatedCSPReports(h func(CSPReport), w *safehttp.ResponseWriter, b
 
 var reportHandlers = map[string]func(json.RawMessage) (body interface{}, ok bool){
 	"csp-violation": cspViolationHandler,
+	"coop":          coopViolationHandler,
+	"coep":          coepViolationHandler,
 }
 
 func handleReport(h func(Report), w *safehttp.ResponseWriter, b []byte) safehttp.Result {
@@ -267,3 +389,55 @@ func cspViolationHandler(m json.RawMessage) (body interface{}, ok bool) {
 		ColumnNumber:      r.ColumnNumber,
 	}, true
 }
+
+// coopViolationHandler parses reports of type coop and returns a COOPReport.
+func coopViolationHandler(m json.RawMessage) (body interface{}, ok bool) {
+	r := struct {
+		Disposition         string `json:"disposition"`
+		EffectivePolicy     string `json:"effectivePolicy"`
+		Type                string `json:"type"`
+		PreviousResponseURL string `json:"previousResponseURL"`
+		NextResponseURL     string `json:"nextResponseURL"`
+		Referrer            string `json:"referrer"`
+		Property            string `json:"property"`
+		SourceFile          string `json:"sourceFile"`
+		LineNumber          uint   `json:"lineNumber"`
+		ColumnNumber        uint   `json:"columnNumber"`
+	}{}
+	if err := json.Unmarshal(m, &r); err != nil {
+		return nil, false
+	}
+
+	return COOPReport{
+		Disposition:         r.Disposition,
+		EffectivePolicy:     r.EffectivePolicy,
+		ViolationType:       r.Type,
+		PreviousResponseURL: r.PreviousResponseURL,
+		NextResponseURL:     r.NextResponseURL,
+		Referrer:            r.Referrer,
+		Property:            r.Property,
+		SourceFile:          r.SourceFile,
+		LineNumber:          r.LineNumber,
+		ColumnNumber:        r.ColumnNumber,
+	}, true
+}
+
+// coepViolationHandler parses reports of type coep and returns a COEPReport.
+func coepViolationHandler(m json.RawMessage) (body interface{}, ok bool) {
+	r := struct {
+		Disposition string `json:"disposition"`
+		Type        string `json:"type"`
+		BlockedURL  string `json:"blockedURL"`
+		Destination string `json:"destination"`
+	}{}
+	if err := json.Unmarshal(m, &r); err != nil {
+		return nil, false
+	}
+
+	return COEPReport{
+		Disposition:   r.Disposition,
+		ViolationType: r.Type,
+		BlockedURL:    r.BlockedURL,
+		Destination:   r.Destination,
+	}, true
+}
@@ -150,6 +150,66 @@ func TestValidReport(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "coop",
+			report: `[{
+				"type": "coop",
+				"age": 10,
+				"url": "https://example.com/vulnerable-page/",
+				"userAgent": "chrome",
+				"body": {
+					"disposition": "reporting",
+					"effectivePolicy": "same-origin",
+					"type": "navigation-to-response",
+					"previousResponseURL": "https://evil.com/",
+					"referrer": "https://evil.com/"
+				}
+			}]`,
+			want: []collector.Report{
+				collector.Report{
+					Type:      "coop",
+					Age:       10,
+					URL:       "https://example.com/vulnerable-page/",
+					UserAgent: "chrome",
+					Body: collector.COOPReport{
+						Disposition:         "reporting",
+						EffectivePolicy:     "same-origin",
+						ViolationType:       "navigation-to-response",
+						PreviousResponseURL: "https://evil.com/",
+						Referrer:            "https://evil.com/",
+					},
+				},
+			},
+		},
+		{
+			name: "coep",
+			report: `[{
+				"type": "coep",
+				"age": 10,
+				"url": "https://example.com/vulnerable-page/",
+				"userAgent": "chrome",
+				"body": {
+					"disposition": "enforce",
+					"type": "corp",
+					"blockedURL": "https://other.com/image.png",
+					"destination": "image"
+				}
+			}]`,
+			want: []collector.Report{
+				collector.Report{
+					Type:      "coep",
+					Age:       10,
+					URL:       "https://example.com/vulnerable-page/",
+					UserAgent: "chrome",
+					Body: collector.COEPReport{
+						Disposition:   "enforce",
+						ViolationType: "corp",
+						BlockedURL:    "https://other.com/image.png",
+						Destination:   "image",
+					},
+				},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -459,3 +519,85 @@ func TestInvalidRequest(t *testing.T) {
 		})
 	}
 }
+
+func TestCSPReportTrustedTypes(t *testing.T) {
+	tests := []struct {
+		name   string
+		report collector.CSPReport
+		want   collector.TrustedTypesReport
+		wantOK bool
+	}{
+		{
+			name: "Sink violation",
+			report: collector.CSPReport{
+				BlockedURL:         "trusted-types-sink",
+				Disposition:        "enforce",
+				DocumentURL:        "https://example.com/",
+				EffectiveDirective: "require-trusted-types-for",
+				Sample:             "Element innerHTML|<img src=x onerror=alert(1)>",
+				SourceFile:         "https://example.com/app.js",
+				LineNumber:         10,
+				ColumnNumber:       17,
+			},
+			want: collector.TrustedTypesReport{
+				Type:         "trusted-types-sink",
+				Sink:         "Element innerHTML",
+				Sample:       "<img src=x onerror=alert(1)>",
+				Disposition:  "enforce",
+				DocumentURL:  "https://example.com/",
+				SourceFile:   "https://example.com/app.js",
+				LineNumber:   10,
+				ColumnNumber: 17,
+			},
+			wantOK: true,
+		},
+		{
+			name: "Policy violation",
+			report: collector.CSPReport{
+				BlockedURL:         "trusted-types-policy",
+				Disposition:        "report",
+				DocumentURL:        "https://example.com/",
+				EffectiveDirective: "trusted-types",
+				Sample:             "evil",
+			},
+			want: collector.TrustedTypesReport{
+				Type:        "trusted-types-policy",
+				Policy:      "evil",
+				Disposition: "report",
+				DocumentURL: "https://example.com/",
+			},
+			wantOK: true,
+		},
+		{
+			name: "Sink violation without blocked URL",
+			report: collector.CSPReport{
+				EffectiveDirective: "require-trusted-types-for",
+				Sample:             "Element innerHTML",
+			},
+			want: collector.TrustedTypesReport{
+				Type: "trusted-types-sink",
+				Sink: "Element innerHTML",
+			},
+			wantOK: true,
+		},
+		{
+			name: "Other violation",
+			report: collector.CSPReport{
+				BlockedURL:         "https://evil.com/",
+				EffectiveDirective: "script-src-elem",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := tt.report.TrustedTypes()
+			if ok != tt.wantOK {
+				t.Errorf("tt.report.TrustedTypes() got ok: %v want: %v", ok, tt.wantOK)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("tt.report.TrustedTypes() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cors provides a safehttp.Interceptor implementing Cross-Origin
+// Resource Sharing.
+//
+// See https://fetch.spec.whatwg.org/#http-cors-protocol for more details.
+package cors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+var simpleMethods = map[string]bool{
+	safehttp.MethodGet:  true,
+	safehttp.MethodHead: true,
+	safehttp.MethodPost: true,
+}
+
+// Interceptor implements CORS. It claims the Access-Control-* headers of all
+// the responses, so that they can't be set by handlers, and only sets them on
+// the routes registered with a Config. The responses of other routes can't be
+// read by cross-origin requests.
+//
+// Preflight requests are answered by the Interceptor before the handler is
+// called. They are dispatched to the Interceptor even if no handler is
+// registered for the OPTIONS method of the route, in which case the Config of
+// the first handler registered for the route with a Config is used.
+//
+// When used together with the Fetch Metadata plugin, the Interceptor must be
+// installed before it, so that the cross-origin requests it allows are
+// exempted from the Fetch Metadata policies.
+type Interceptor struct{}
+
+type allowedCtxKey struct{}
+
+// Allowed reports whether the request is a cross-origin request made with the
+// CORS protocol and allowed by the Config of the route serving it. Navigations
+// and no-cors requests, e.g. cross-site form submissions, are never reported
+// as allowed, even if their Origin is, since the browser doesn't enforce CORS
+// on them.
+func Allowed(r *safehttp.IncomingRequest) bool {
+	ok, _ := r.Context().Value(allowedCtxKey{}).(bool)
+	return ok
+}
+
+// Before claims the Access-Control-* headers and checks the Origin of the
+// request against the Config of the route, if any. Preflight requests are
+// answered with a 204 No Content response if they are allowed, and
+// cross-origin requests that aren't allowed are rejected with a 403 Forbidden
+// error.
+//
+// If the Config is invalid, e.g. because it allows credentials to be sent
+// from any origin, requests are rejected with a 500 Internal Server Error.
+// This only happens if Before is called directly, since
+// safehttp.ServeMux.Handle panics when passed an invalid Config.
+func (Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	h := w.Header()
+	setAllowOrigin := h.Claim("Access-Control-Allow-Origin")
+	setAllowCredentials := h.Claim("Access-Control-Allow-Credentials")
+	setAllowMethods := h.Claim("Access-Control-Allow-Methods")
+	setAllowHeaders := h.Claim("Access-Control-Allow-Headers")
+	setMaxAge := h.Claim("Access-Control-Max-Age")
+	setExposeHeaders := h.Claim("Access-Control-Expose-Headers")
+
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == r.Scheme()+"://"+r.Host() {
+		// Not a cross-origin request.
+		return safehttp.NotWritten()
+	}
+	c, ok := cfg.(Config)
+	if !ok {
+		return safehttp.NotWritten()
+	}
+	if err := c.Validate(); err != nil {
+		return w.WriteError(safehttp.StatusInternalServerError)
+	}
+	if !h.IsClaimed("Vary") {
+		h.Add("Vary", "Origin")
+	}
+	if !c.allowsOrigin(origin) {
+		return w.WriteError(safehttp.StatusForbidden)
+	}
+
+	if c.AllowCredentials {
+		setAllowOrigin([]string{origin})
+		setAllowCredentials([]string{"true"})
+	} else if c.allowsAnyOrigin() {
+		setAllowOrigin([]string{"*"})
+	} else {
+		setAllowOrigin([]string{origin})
+	}
+
+	reqMethod := r.Header.Get("Access-Control-Request-Method")
+	if r.Method() != safehttp.MethodOptions || reqMethod == "" {
+		if len(c.ExposedHeaders) > 0 {
+			setExposeHeaders([]string{strings.Join(c.ExposedHeaders, ", ")})
+		}
+		// The Sec-Fetch-Mode header is missing on browsers that don't support
+		// Fetch Metadata.
+		if mode := r.Header.Get("Sec-Fetch-Mode"); mode == "" || mode == "cors" {
+			r.SetContext(context.WithValue(r.Context(), allowedCtxKey{}, true))
+		}
+		return safehttp.NotWritten()
+	}
+
+	// Preflight request.
+	if !c.allowsMethod(reqMethod) {
+		return w.WriteError(safehttp.StatusForbidden)
+	}
+	var reqHeaders []string
+	for _, v := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, hdr := range strings.Split(v, ",") {
+			if hdr = strings.TrimSpace(hdr); hdr != "" {
+				reqHeaders = append(reqHeaders, hdr)
+			}
+		}
+	}
+	for _, hdr := range reqHeaders {
+		if !c.allowsHeader(hdr) {
+			return w.WriteError(safehttp.StatusForbidden)
+		}
+	}
+	if len(c.AllowedMethods) > 0 {
+		setAllowMethods([]string{strings.Join(c.AllowedMethods, ", ")})
+	}
+	if len(reqHeaders) > 0 {
+		setAllowHeaders([]string{strings.Join(reqHeaders, ", ")})
+	}
+	if c.MaxAge > 0 {
+		setMaxAge([]string{strconv.FormatInt(int64(c.MaxAge.Seconds()), 10)})
+	}
+	return w.NoContent()
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Interceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to allow
+// cross-origin requests on a specific route.
+type Config struct {
+	// AllowedOrigins are the origins, e.g. "https://example.com", allowed to
+	// send cross-origin requests. The "*" wildcard allows all the origins, it
+	// can't be used together with AllowCredentials. The "null" origin can't be
+	// allowed, since it can be used by any document, e.g. sandboxed ones.
+	AllowedOrigins []string
+	// AllowedMethods are the methods allowed in addition to GET, HEAD and
+	// POST, which are always allowed by browsers.
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed in addition to the
+	// CORS-safelisted ones. Header names are compared case-insensitively.
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers exposed to the cross-origin
+	// requests in addition to the CORS-safelisted ones.
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and other credentials to be sent with
+	// the cross-origin requests.
+	AllowCredentials bool
+	// MaxAge is the duration for which the response to a preflight request can
+	// be cached. If zero, the browser's default is used. It will be rounded
+	// to seconds before use.
+	MaxAge time.Duration
+}
+
+// Match returns true if the interceptor is a CORS Interceptor.
+func (Config) Match(i safehttp.Interceptor) bool {
+	switch i.(type) {
+	case Interceptor, *Interceptor:
+		return true
+	}
+	return false
+}
+
+// HandleOptions returns true, so that preflight requests are dispatched to
+// the Interceptor even if no handler is registered for the OPTIONS method.
+func (Config) HandleOptions() bool {
+	return true
+}
+
+// Validate returns an error if the Config is invalid, e.g. because it
+// doesn't allow any origin, allows credentials to be sent from any origin or
+// contains malformed origins. It's called by safehttp.ServeMux.Handle, which
+// panics if the Config is invalid.
+func (c Config) Validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("no allowed origins")
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			if c.AllowCredentials {
+				return errors.New("credentials can't be allowed for any origin")
+			}
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || u.Scheme != "https" && u.Scheme != "http" || u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return fmt.Errorf("invalid origin %q", o)
+		}
+	}
+	for _, h := range c.AllowedHeaders {
+		if h == "*" {
+			return errors.New("the wildcard can't be used for headers")
+		}
+	}
+	if c.MaxAge < 0 {
+		return errors.New("negative max age")
+	}
+	return nil
+}
+
+func (c Config) allowsAnyOrigin() bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) allowsOrigin(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" || o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) allowsMethod(method string) bool {
+	if simpleMethods[method] {
+		return true
+	}
+	for _, m := range c.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Config) allowsHeader(header string) bool {
+	for _, h := range c.AllowedHeaders {
+		if strings.EqualFold(h, header) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,471 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cors_test
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cors"
+	"github.com/google/go-safeweb/safehttp/plugins/fetch_metadata"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+var testConfig = cors.Config{
+	AllowedOrigins:   []string{"https://bar.com"},
+	AllowedMethods:   []string{safehttp.MethodPut},
+	AllowedHeaders:   []string{"Content-Type", "X-Pizza"},
+	ExposedHeaders:   []string{"X-Total"},
+	AllowCredentials: true,
+	MaxAge:           time.Hour,
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		headers     map[string]string
+		cfg         interface{}
+		wantStatus  safehttp.StatusCode
+		wantHeaders map[string][]string
+		wantAllowed bool
+	}{
+		{
+			name:        "No Origin",
+			method:      safehttp.MethodGet,
+			cfg:         testConfig,
+			wantStatus:  safehttp.StatusOK,
+			wantHeaders: map[string][]string{},
+		},
+		{
+			name:        "Same origin",
+			method:      safehttp.MethodPost,
+			headers:     map[string]string{"Origin": "https://foo.com"},
+			cfg:         testConfig,
+			wantStatus:  safehttp.StatusOK,
+			wantHeaders: map[string][]string{},
+		},
+		{
+			name:        "No Config",
+			method:      safehttp.MethodGet,
+			headers:     map[string]string{"Origin": "https://bar.com"},
+			wantStatus:  safehttp.StatusOK,
+			wantHeaders: map[string][]string{},
+		},
+		{
+			name:       "Allowed request",
+			method:     safehttp.MethodGet,
+			headers:    map[string]string{"Origin": "https://bar.com"},
+			cfg:        testConfig,
+			wantStatus: safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Access-Control-Allow-Origin":      {"https://bar.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Expose-Headers":    {"X-Total"},
+				"Vary":                             {"Origin"},
+			},
+			wantAllowed: true,
+		},
+		{
+			name:       "Wildcard origin",
+			method:     safehttp.MethodGet,
+			headers:    map[string]string{"Origin": "https://bar.com"},
+			cfg:        cors.Config{AllowedOrigins: []string{"*"}},
+			wantStatus: safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Access-Control-Allow-Origin": {"*"},
+				"Vary":                        {"Origin"},
+			},
+			wantAllowed: true,
+		},
+		{
+			name:       "Disallowed origin",
+			method:     safehttp.MethodPost,
+			headers:    map[string]string{"Origin": "https://evil.com"},
+			cfg:        testConfig,
+			wantStatus: safehttp.StatusForbidden,
+			wantHeaders: map[string][]string{
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+				"Vary":                   {"Origin"},
+			},
+		},
+		{
+			name:   "Preflight",
+			method: safehttp.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://bar.com",
+				"Access-Control-Request-Method":  safehttp.MethodPut,
+				"Access-Control-Request-Headers": "x-pizza, content-type",
+			},
+			cfg:        testConfig,
+			wantStatus: safehttp.StatusNoContent,
+			wantHeaders: map[string][]string{
+				"Access-Control-Allow-Origin":      {"https://bar.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Access-Control-Allow-Methods":     {"PUT"},
+				"Access-Control-Allow-Headers":     {"x-pizza, content-type"},
+				"Access-Control-Max-Age":           {"3600"},
+				"Vary":                             {"Origin"},
+			},
+		},
+		{
+			name:   "Preflight disallowed method",
+			method: safehttp.MethodOptions,
+			headers: map[string]string{
+				"Origin":                        "https://bar.com",
+				"Access-Control-Request-Method": safehttp.MethodDelete,
+			},
+			cfg:        testConfig,
+			wantStatus: safehttp.StatusForbidden,
+			wantHeaders: map[string][]string{
+				"Access-Control-Allow-Origin":      {"https://bar.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Content-Type":                     {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options":           {"nosniff"},
+				"Vary":                             {"Origin"},
+			},
+		},
+		{
+			name:   "Preflight disallowed header",
+			method: safehttp.MethodOptions,
+			headers: map[string]string{
+				"Origin":                         "https://bar.com",
+				"Access-Control-Request-Method":  safehttp.MethodPost,
+				"Access-Control-Request-Headers": "Authorization",
+			},
+			cfg:        testConfig,
+			wantStatus: safehttp.StatusForbidden,
+			wantHeaders: map[string][]string{
+				"Access-Control-Allow-Origin":      {"https://bar.com"},
+				"Access-Control-Allow-Credentials": {"true"},
+				"Content-Type":                     {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options":           {"nosniff"},
+				"Vary":                             {"Origin"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(tt.method, "https://foo.com/pizza", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			cors.Interceptor{}.Before(rr.ResponseWriter, req, tt.cfg)
+
+			if rr.Status() != tt.wantStatus {
+				t.Errorf("rr.Status() got: %v want: %v", rr.Status(), tt.wantStatus)
+			}
+			if diff := cmp.Diff(tt.wantHeaders, map[string][]string(rr.Header())); diff != "" {
+				t.Errorf("rr.Header() mismatch (-want +got):\n%s", diff)
+			}
+			if got := cors.Allowed(req); got != tt.wantAllowed {
+				t.Errorf("cors.Allowed(req) got: %v want: %v", got, tt.wantAllowed)
+			}
+		})
+	}
+}
+
+func TestCORSInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  cors.Config
+	}{
+		{
+			name: "No origins",
+			cfg:  cors.Config{},
+		},
+		{
+			name: "Wildcard with credentials",
+			cfg:  cors.Config{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		},
+		{
+			name: "Null origin",
+			cfg:  cors.Config{AllowedOrigins: []string{"null"}},
+		},
+		{
+			name: "Origin with path",
+			cfg:  cors.Config{AllowedOrigins: []string{"https://bar.com/"}},
+		},
+		{
+			name: "Wildcard headers",
+			cfg:  cors.Config{AllowedOrigins: []string{"https://bar.com"}, AllowedHeaders: []string{"*"}},
+		},
+		{
+			name: "Negative max age",
+			cfg:  cors.Config{AllowedOrigins: []string{"https://bar.com"}, MaxAge: -time.Second},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/pizza", nil)
+			req.Header.Set("Origin", "https://bar.com")
+
+			cors.Interceptor{}.Before(rr.ResponseWriter, req, tt.cfg)
+
+			if want := safehttp.StatusInternalServerError; rr.Status() != want {
+				t.Errorf("rr.Status() got: %v want: %v", rr.Status(), want)
+			}
+		})
+
+		t.Run(tt.name+" Handle", func(t *testing.T) {
+			mux := safehttp.NewServeMux(nil, "foo.com")
+			mux.Install(cors.Interceptor{})
+			h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return w.NoContent()
+			})
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("mux.Handle(%v) expected panic", tt.cfg)
+				}
+			}()
+			mux.Handle("/pizza", safehttp.MethodGet, h, tt.cfg)
+		})
+	}
+}
+
+func TestCORSPreflightWithoutOptionsHandler(t *testing.T) {
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(cors.Interceptor{})
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.NoContent()
+	})
+	mux.Handle("/api", safehttp.MethodPut, h, testConfig)
+	mux.Handle("/private", safehttp.MethodPut, h)
+
+	tests := []struct {
+		name            string
+		path            string
+		origin          string
+		reqMethod       string
+		wantStatus      int
+		wantAllowOrigin string
+	}{
+		{
+			name:            "Preflight",
+			path:            "/api",
+			origin:          "https://bar.com",
+			reqMethod:       safehttp.MethodPut,
+			wantStatus:      int(safehttp.StatusNoContent),
+			wantAllowOrigin: "https://bar.com",
+		},
+		{
+			name:       "Preflight from disallowed origin",
+			path:       "/api",
+			origin:     "https://evil.com",
+			reqMethod:  safehttp.MethodPut,
+			wantStatus: int(safehttp.StatusForbidden),
+		},
+		{
+			name:       "OPTIONS request that isn't a preflight",
+			path:       "/api",
+			wantStatus: int(safehttp.StatusMethodNotAllowed),
+		},
+		{
+			name:       "Route without Config",
+			path:       "/private",
+			origin:     "https://bar.com",
+			reqMethod:  safehttp.MethodPut,
+			wantStatus: int(safehttp.StatusMethodNotAllowed),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(safehttp.MethodOptions, "https://foo.com"+tt.path, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.reqMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("rec.Code got: %v want: %v", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf(`rec.Header().Get("Access-Control-Allow-Origin") got: %q want: %q`, got, tt.wantAllowOrigin)
+			}
+		})
+	}
+}
+
+func TestCORSClaimsHeaders(t *testing.T) {
+	rr := safehttptest.NewResponseRecorder()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/pizza", nil)
+
+	cors.Interceptor{}.Before(rr.ResponseWriter, req, nil)
+
+	for _, h := range []string{
+		"Access-Control-Allow-Origin",
+		"Access-Control-Allow-Credentials",
+		"Access-Control-Allow-Methods",
+		"Access-Control-Allow-Headers",
+		"Access-Control-Max-Age",
+		"Access-Control-Expose-Headers",
+	} {
+		if !rr.ResponseWriter.Header().IsClaimed(h) {
+			t.Errorf("rr.ResponseWriter.Header().IsClaimed(%q) got: false want: true", h)
+		}
+	}
+}
+
+func TestCORSWithFetchMetadata(t *testing.T) {
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(cors.Interceptor{})
+	mux.Install(fetchmetadata.NewPlugin())
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.NoContent()
+	})
+	mux.Handle("/api", safehttp.MethodPost, h, testConfig)
+	mux.Handle("/api", safehttp.MethodOptions, h, testConfig)
+	mux.Handle("/private", safehttp.MethodPost, h)
+	mux.Handle("/public", safehttp.MethodPost, h, cors.Config{AllowedOrigins: []string{"*"}})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		origin     string
+		mode       string
+		dest       string
+		wantStatus int
+	}{
+		{
+			name:       "Allowed origin",
+			method:     safehttp.MethodPost,
+			path:       "/api",
+			origin:     "https://bar.com",
+			mode:       "cors",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusNoContent),
+		},
+		{
+			name:       "Preflight",
+			method:     safehttp.MethodOptions,
+			path:       "/api",
+			origin:     "https://bar.com",
+			mode:       "cors",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusNoContent),
+		},
+		{
+			name:       "Disallowed origin",
+			method:     safehttp.MethodPost,
+			path:       "/api",
+			origin:     "https://evil.com",
+			mode:       "cors",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusForbidden),
+		},
+		{
+			name:       "Route without Config",
+			method:     safehttp.MethodPost,
+			path:       "/private",
+			origin:     "https://bar.com",
+			mode:       "cors",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusForbidden),
+		},
+		{
+			name:       "Any origin",
+			method:     safehttp.MethodPost,
+			path:       "/public",
+			origin:     "https://evil.com",
+			mode:       "cors",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusNoContent),
+		},
+		{
+			name:       "Any origin without Sec-Fetch-Mode",
+			method:     safehttp.MethodPost,
+			path:       "/public",
+			origin:     "https://evil.com",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusNoContent),
+		},
+		{
+			name:       "Any origin form submission",
+			method:     safehttp.MethodPost,
+			path:       "/public",
+			origin:     "https://evil.com",
+			mode:       "navigate",
+			dest:       "document",
+			wantStatus: int(safehttp.StatusForbidden),
+		},
+		{
+			name:       "Any origin no-cors request",
+			method:     safehttp.MethodPost,
+			path:       "/public",
+			origin:     "https://evil.com",
+			mode:       "no-cors",
+			dest:       "empty",
+			wantStatus: int(safehttp.StatusForbidden),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "https://foo.com"+tt.path, nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Sec-Fetch-Site", "cross-site")
+			if tt.mode != "" {
+				req.Header.Set("Sec-Fetch-Mode", tt.mode)
+			}
+			req.Header.Set("Sec-Fetch-Dest", tt.dest)
+			if tt.method == safehttp.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", safehttp.MethodPost)
+			}
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("rec.Code got: %v want: %v", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		it   safehttp.Interceptor
+		want bool
+	}{
+		{name: "Interceptor", it: cors.Interceptor{}, want: true},
+		{name: "Pointer to Interceptor", it: &cors.Interceptor{}, want: true},
+		{name: "Other interceptor", it: fetchmetadata.NewPlugin(), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (cors.Config{}).Match(tt.it); got != tt.want {
+				t.Errorf("cors.Config{}.Match(tt.it) got: %v want: %v", got, tt.want)
+			}
+		})
+	}
+}
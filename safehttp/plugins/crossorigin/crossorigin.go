@@ -0,0 +1,224 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package crossorigin provides a safehttp.Interceptor setting the
+// Cross-Origin-Opener-Policy, Cross-Origin-Embedder-Policy and
+// Cross-Origin-Resource-Policy headers, which isolate the application from
+// other origins.
+//
+// See https://web.dev/coop-coep/ and https://resourcepolicy.fyi/ for more
+// details.
+package crossorigin
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/google/go-safeweb/safehttp"
+)
+
+// ReportingEndpoint is the name of the reporting endpoint the policies report
+// to, declared in the Reporting-Endpoints header when a ReportURL is set.
+const ReportingEndpoint = "crossorigin"
+
+var (
+	openerPolicies = map[string]bool{
+		"unsafe-none":              true,
+		"same-origin-allow-popups": true,
+		"same-origin":              true,
+		"noopener-allow-popups":    true,
+	}
+	embedderPolicies = map[string]bool{
+		"unsafe-none":    true,
+		"require-corp":   true,
+		"credentialless": true,
+	}
+	resourcePolicies = map[string]bool{
+		"same-site":    true,
+		"same-origin":  true,
+		"cross-origin": true,
+	}
+)
+
+// Interceptor claims and sets the cross-origin isolation headers. Policies
+// left empty aren't set.
+type Interceptor struct {
+	// OpenerPolicy is the value of the Cross-Origin-Opener-Policy header,
+	// e.g. "same-origin".
+	OpenerPolicy string
+	// OpenerPolicyReportOnly is the value of the
+	// Cross-Origin-Opener-Policy-Report-Only header.
+	OpenerPolicyReportOnly string
+	// EmbedderPolicy is the value of the Cross-Origin-Embedder-Policy header,
+	// e.g. "require-corp".
+	EmbedderPolicy string
+	// EmbedderPolicyReportOnly is the value of the
+	// Cross-Origin-Embedder-Policy-Report-Only header.
+	EmbedderPolicyReportOnly string
+	// ResourcePolicy is the value of the Cross-Origin-Resource-Policy header,
+	// e.g. "same-origin". It has no report-only variant.
+	ResourcePolicy string
+	// ReportURL is the URL the violations of the opener and embedder
+	// policies are reported to, e.g. the path of a collector.Handler. If
+	// empty, violations aren't reported.
+	ReportURL string
+}
+
+// Default creates a new cross-origin isolation interceptor with safe
+// defaults, reporting violations to reportURL if it's not empty. These safe
+// defaults are:
+//   - Cross-Origin-Opener-Policy: same-origin
+//   - Cross-Origin-Resource-Policy: same-origin
+//   - Cross-Origin-Embedder-Policy-Report-Only: require-corp
+//
+// The embedder policy is only reported, since enforcing it requires all the
+// cross-origin resources embedded by the application to opt in.
+func Default(reportURL string) Interceptor {
+	return Interceptor{
+		OpenerPolicy:             "same-origin",
+		EmbedderPolicyReportOnly: "require-corp",
+		ResourcePolicy:           "same-origin",
+		ReportURL:                reportURL,
+	}
+}
+
+// Before claims and sets the Cross-Origin-Opener-Policy,
+// Cross-Origin-Embedder-Policy and Cross-Origin-Resource-Policy headers and
+// their report-only variants. A Config can be passed to override the policies
+// on a specific route. If a policy isn't valid, a 500 Internal Server Error
+// response is written instead. Invalid Configs only get here if Before is
+// called directly, since safehttp.ServeMux.Handle panics when passed one.
+func (it Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	c, _ := cfg.(Config)
+
+	h := w.Header()
+	setCOOP := h.Claim("Cross-Origin-Opener-Policy")
+	setCOOPReportOnly := h.Claim("Cross-Origin-Opener-Policy-Report-Only")
+	setCOEP := h.Claim("Cross-Origin-Embedder-Policy")
+	setCOEPReportOnly := h.Claim("Cross-Origin-Embedder-Policy-Report-Only")
+	setCORP := h.Claim("Cross-Origin-Resource-Policy")
+
+	coop, coopRO := override(it.OpenerPolicy, it.OpenerPolicyReportOnly, c.OpenerPolicy)
+	coep, coepRO := override(it.EmbedderPolicy, it.EmbedderPolicyReportOnly, c.EmbedderPolicy)
+	corp := it.ResourcePolicy
+	if corp != "" && c.ResourcePolicy != "" {
+		corp = c.ResourcePolicy
+	}
+
+	for _, p := range []string{coop, coopRO} {
+		if p != "" && !openerPolicies[p] {
+			return w.WriteError(safehttp.StatusInternalServerError)
+		}
+	}
+	for _, p := range []string{coep, coepRO} {
+		if p != "" && !embedderPolicies[p] {
+			return w.WriteError(safehttp.StatusInternalServerError)
+		}
+	}
+	if corp != "" && !resourcePolicies[corp] {
+		return w.WriteError(safehttp.StatusInternalServerError)
+	}
+
+	setCOOP(it.value(coop))
+	setCOOPReportOnly(it.value(coopRO))
+	setCOEP(it.value(coep))
+	setCOEPReportOnly(it.value(coepRO))
+	if corp != "" {
+		setCORP([]string{corp})
+	}
+	if it.ReportURL != "" && (coop != "" || coopRO != "" || coep != "" || coepRO != "") && !h.IsClaimed("Reporting-Endpoints") {
+		h.Add("Reporting-Endpoints", ReportingEndpoint+"="+strconv.Quote(it.ReportURL))
+	}
+	return safehttp.NotWritten()
+}
+
+// override returns the enforced and report-only policies, replaced by the
+// policy of the route if it's not empty. Policies that aren't set by the
+// Interceptor stay unset.
+func override(enforce, reportOnly, route string) (string, string) {
+	if route == "" {
+		return enforce, reportOnly
+	}
+	if enforce != "" {
+		enforce = route
+	}
+	if reportOnly != "" {
+		reportOnly = route
+	}
+	return enforce, reportOnly
+}
+
+// value returns the header value of a policy reporting to the reporting
+// endpoint, if any, or nil if the policy is empty.
+func (it Interceptor) value(policy string) []string {
+	if policy == "" {
+		return nil
+	}
+	if it.ReportURL != "" {
+		policy += `; report-to="` + ReportingEndpoint + `"`
+	}
+	return []string{policy}
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to change the
+// policies applied by the Interceptor on a specific route. Each policy that
+// isn't empty replaces the corresponding policy of the Interceptor, both in
+// the enforced and in the report-only headers. Policies that aren't set by
+// the Interceptor can't be set on a specific route.
+type Config struct {
+	// OpenerPolicy overrides the Cross-Origin-Opener-Policy, e.g. with
+	// "same-origin-allow-popups" on pages opening OAuth popups.
+	OpenerPolicy string
+	// EmbedderPolicy overrides the Cross-Origin-Embedder-Policy, e.g. with
+	// "unsafe-none" on pages embedding cross-origin resources that don't
+	// opt in.
+	EmbedderPolicy string
+	// ResourcePolicy overrides the Cross-Origin-Resource-Policy, e.g. with
+	// "cross-origin" on resources meant to be embedded by other sites.
+	ResourcePolicy string
+}
+
+// Match returns true if the interceptor is a cross-origin isolation
+// Interceptor.
+func (Config) Match(i safehttp.Interceptor) bool {
+	switch i.(type) {
+	case Interceptor, *Interceptor:
+		return true
+	}
+	return false
+}
+
+// Validate returns an error if one of the policies of the Config isn't valid,
+// e.g. because of a typo. It's called by safehttp.ServeMux.Handle, which
+// panics if the Config is invalid.
+func (c Config) Validate() error {
+	if c.OpenerPolicy != "" && !openerPolicies[c.OpenerPolicy] {
+		return fmt.Errorf("invalid Cross-Origin-Opener-Policy %q", c.OpenerPolicy)
+	}
+	if c.EmbedderPolicy != "" && !embedderPolicies[c.EmbedderPolicy] {
+		return fmt.Errorf("invalid Cross-Origin-Embedder-Policy %q", c.EmbedderPolicy)
+	}
+	if c.ResourcePolicy != "" && !resourcePolicies[c.ResourcePolicy] {
+		return fmt.Errorf("invalid Cross-Origin-Resource-Policy %q", c.ResourcePolicy)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crossorigin_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/crossorigin"
+	"github.com/google/go-safeweb/safehttp/plugins/hsts"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+func TestCrossOrigin(t *testing.T) {
+	tests := []struct {
+		name        string
+		interceptor crossorigin.Interceptor
+		cfg         interface{}
+		wantStatus  safehttp.StatusCode
+		wantHeaders map[string][]string
+	}{
+		{
+			name:        "Default",
+			interceptor: crossorigin.Default(""),
+			wantStatus:  safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Cross-Origin-Opener-Policy":               {"same-origin"},
+				"Cross-Origin-Embedder-Policy-Report-Only": {"require-corp"},
+				"Cross-Origin-Resource-Policy":             {"same-origin"},
+			},
+		},
+		{
+			name:        "Default with reporting",
+			interceptor: crossorigin.Default("/collector"),
+			wantStatus:  safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Cross-Origin-Opener-Policy":               {`same-origin; report-to="crossorigin"`},
+				"Cross-Origin-Embedder-Policy-Report-Only": {`require-corp; report-to="crossorigin"`},
+				"Cross-Origin-Resource-Policy":             {"same-origin"},
+				"Reporting-Endpoints":                      {`crossorigin="/collector"`},
+			},
+		},
+		{
+			name: "Enforced and report-only",
+			interceptor: crossorigin.Interceptor{
+				OpenerPolicy:             "same-origin-allow-popups",
+				OpenerPolicyReportOnly:   "same-origin",
+				EmbedderPolicy:           "credentialless",
+				EmbedderPolicyReportOnly: "require-corp",
+			},
+			wantStatus: safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Cross-Origin-Opener-Policy":               {"same-origin-allow-popups"},
+				"Cross-Origin-Opener-Policy-Report-Only":   {"same-origin"},
+				"Cross-Origin-Embedder-Policy":             {"credentialless"},
+				"Cross-Origin-Embedder-Policy-Report-Only": {"require-corp"},
+			},
+		},
+		{
+			name:        "Route override",
+			interceptor: crossorigin.Default(""),
+			cfg: crossorigin.Config{
+				OpenerPolicy:   "same-origin-allow-popups",
+				ResourcePolicy: "cross-origin",
+			},
+			wantStatus: safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Cross-Origin-Opener-Policy":               {"same-origin-allow-popups"},
+				"Cross-Origin-Embedder-Policy-Report-Only": {"require-corp"},
+				"Cross-Origin-Resource-Policy":             {"cross-origin"},
+			},
+		},
+		{
+			name:        "Route override of unset policy",
+			interceptor: crossorigin.Interceptor{OpenerPolicy: "same-origin"},
+			cfg:         crossorigin.Config{EmbedderPolicy: "require-corp"},
+			wantStatus:  safehttp.StatusOK,
+			wantHeaders: map[string][]string{
+				"Cross-Origin-Opener-Policy": {"same-origin"},
+			},
+		},
+		{
+			name:        "Invalid policy",
+			interceptor: crossorigin.Interceptor{OpenerPolicy: "same-site"},
+			wantStatus:  safehttp.StatusInternalServerError,
+			wantHeaders: map[string][]string{
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+		{
+			name:        "Invalid route policy",
+			interceptor: crossorigin.Default(""),
+			cfg:         crossorigin.Config{ResourcePolicy: "none"},
+			wantStatus:  safehttp.StatusInternalServerError,
+			wantHeaders: map[string][]string{
+				"Content-Type":           {"text/plain; charset=utf-8"},
+				"X-Content-Type-Options": {"nosniff"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil)
+
+			tt.interceptor.Before(rr.ResponseWriter, req, tt.cfg)
+
+			if rr.Status() != tt.wantStatus {
+				t.Errorf("rr.Status() got: %v want: %v", rr.Status(), tt.wantStatus)
+			}
+			if diff := cmp.Diff(tt.wantHeaders, map[string][]string(rr.Header())); diff != "" {
+				t.Errorf("rr.Header() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestInvalidConfigHandle(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  crossorigin.Config
+	}{
+		{name: "Opener policy", cfg: crossorigin.Config{OpenerPolicy: "same-origin-allow-popup"}},
+		{name: "Embedder policy", cfg: crossorigin.Config{EmbedderPolicy: "require-cors"}},
+		{name: "Resource policy", cfg: crossorigin.Config{ResourcePolicy: "none"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := safehttp.NewServeMux(nil, "foo.com")
+			mux.Install(crossorigin.Default(""))
+			h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return safehttp.NotWritten()
+			})
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("mux.Handle(%v) expected panic", tt.cfg)
+				}
+			}()
+			mux.Handle("/", safehttp.MethodGet, h, tt.cfg)
+		})
+	}
+}
+
+func TestCrossOriginClaimsHeaders(t *testing.T) {
+	rr := safehttptest.NewResponseRecorder()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/", nil)
+
+	crossorigin.Interceptor{}.Before(rr.ResponseWriter, req, nil)
+
+	for _, h := range []string{
+		"Cross-Origin-Opener-Policy",
+		"Cross-Origin-Opener-Policy-Report-Only",
+		"Cross-Origin-Embedder-Policy",
+		"Cross-Origin-Embedder-Policy-Report-Only",
+		"Cross-Origin-Resource-Policy",
+	} {
+		if !rr.ResponseWriter.Header().IsClaimed(h) {
+			t.Errorf("rr.ResponseWriter.Header().IsClaimed(%q) got: false want: true", h)
+		}
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	tests := []struct {
+		name string
+		it   safehttp.Interceptor
+		want bool
+	}{
+		{name: "Interceptor", it: crossorigin.Interceptor{}, want: true},
+		{name: "Pointer to Interceptor", it: &crossorigin.Interceptor{}, want: true},
+		{name: "Other interceptor", it: hsts.Interceptor{}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (crossorigin.Config{}).Match(tt.it); got != tt.want {
+				t.Errorf("crossorigin.Config{}.Match(tt.it) got: %v want: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"net/url"
 	"strings"
 
 	"github.com/google/go-safeweb/safehttp"
@@ -41,12 +42,13 @@ func generateNonce() string {
 	return base64.StdEncoding.EncodeToString(b)
 }
 
-// Policy defines a CSP policy.
+// Policy defines a CSP policy. Policies can be created with the builders of
+// this package, e.g. StrictCSPBuilder or Builder, or parsed with ParsePolicy.
 type Policy struct {
-	// serialize serializes this policy for use in a Content-Security-Policy header
-	// or in a Content-Security-Policy-Report-Only header. A nonce will be provided
-	// to serialize which can be used in 'nonce-{random-nonce}' values in directives.
-	serialize func(nonce string) string
+	// directives are the directives of the policy, in serialization order.
+	// The NonceSource value is replaced by the nonce of the request when the
+	// policy is serialized.
+	directives []Directive
 }
 
 type ctxKey struct{}
@@ -94,50 +96,34 @@ type StrictCSPBuilder struct {
 
 // Build creates a Policy based on the specified options.
 func (s StrictCSPBuilder) Build() Policy {
-	return Policy{
-		serialize: func(nonce string) string {
-			var b strings.Builder
-
-			// object-src 'none'; script-src 'unsafe-inline' 'nonce-{random}'
-			b.WriteString("object-src 'none'; script-src 'unsafe-inline' 'nonce-")
-			b.WriteString(nonce)
-			b.WriteByte('\'')
-
-			if !s.NoStrictDynamic {
-				b.WriteString(" 'strict-dynamic' https: http:")
-			}
-
-			if s.UnsafeEval {
-				b.WriteString(" 'unsafe-eval'")
-			}
-
-			for _, h := range s.Hashes {
-				b.WriteString(" '")
-				b.WriteString(h)
-				b.WriteByte('\'')
-			}
-
-			b.WriteString("; base-uri ")
-			if s.BaseURI == "" {
-				b.WriteString("'none'")
-			} else {
-				b.WriteString(s.BaseURI)
-			}
+	scriptSrc := []string{"'unsafe-inline'", NonceSource}
+	if !s.NoStrictDynamic {
+		scriptSrc = append(scriptSrc, "'strict-dynamic'", "https:", "http:")
+	}
+	if s.UnsafeEval {
+		scriptSrc = append(scriptSrc, "'unsafe-eval'")
+	}
+	for _, h := range s.Hashes {
+		scriptSrc = append(scriptSrc, "'"+h+"'")
+	}
 
-			if s.ReportURI != "" {
-				b.WriteString("; report-uri ")
-				b.WriteString(s.ReportURI)
-			}
+	baseURI := s.BaseURI
+	if baseURI == "" {
+		baseURI = "'none'"
+	}
 
-			return b.String()
-		},
+	return Policy{
+		directives: withReportURI([]Directive{
+			{Name: "object-src", Values: []string{"'none'"}},
+			{Name: "script-src", Values: scriptSrc},
+			{Name: "base-uri", Values: []string{baseURI}},
+		}, s.ReportURI),
 	}
 }
 
 // FramingPolicyBuilder can be used to create a new CSP policy with frame-ancestors
-// set to 'self'.
-//
-// TODO: allow relaxation on specific endpoints according to #77.
+// set to 'self'. The policy can be relaxed on specific routes with the
+// AllowFraming and FramingAllowlist fields of Config.
 type FramingPolicyBuilder struct {
 	// ReportURI controls the report-uri directive. If ReportUri is empty, no report-uri
 	// directive will be set.
@@ -147,18 +133,70 @@ type FramingPolicyBuilder struct {
 // Build creates a Policy based on the specified options.
 func (f FramingPolicyBuilder) Build() Policy {
 	return Policy{
-		serialize: func(_ string) string {
-			var b strings.Builder
-			b.WriteString("frame-ancestors 'self'")
+		directives: withReportURI([]Directive{
+			{Name: "frame-ancestors", Values: []string{"'self'"}},
+		}, f.ReportURI),
+	}
+}
 
-			if f.ReportURI != "" {
-				b.WriteString("; report-uri ")
-				b.WriteString(f.ReportURI)
-			}
+// TrustedTypesBuilder can be used to create a new CSP policy requiring Trusted
+// Types for the DOM XSS injection sinks, e.g. Element.innerHTML, and
+// restricting the Trusted Types policies the application can create.
+//
+// See https://w3c.github.io/webappsec-trusted-types/dist/spec/ and
+// https://web.dev/trusted-types/ for more info.
+type TrustedTypesBuilder struct {
+	// AllowedPolicies controls the trusted-types directive, listing the names
+	// of the Trusted Types policies the application can create. The "default"
+	// name allows the default policy to be created. If AllowedPolicies is
+	// empty, the directive will be set to 'none' and no policies can be
+	// created. Build panics if a name isn't a valid policy name.
+	AllowedPolicies []string
+	// AllowDuplicates controls whether the trusted-types directive should
+	// contain the 'allow-duplicates' value, allowing multiple policies to be
+	// created with the same name.
+	AllowDuplicates bool
+	// ReportURI controls the report-uri directive. If ReportURI is empty, no
+	// report-uri directive will be set.
+	ReportURI string
+}
 
-			return b.String()
-		},
+// Build creates a Policy based on the specified options.
+func (t TrustedTypesBuilder) Build() Policy {
+	for _, p := range t.AllowedPolicies {
+		if !validTrustedTypesPolicyName(p) {
+			panic(fmt.Sprintf("invalid Trusted Types policy name %q", p))
+		}
+	}
+	trustedTypes := append([]string(nil), t.AllowedPolicies...)
+	if len(trustedTypes) == 0 {
+		trustedTypes = []string{"'none'"}
+	}
+	if t.AllowDuplicates {
+		trustedTypes = append(trustedTypes, "'allow-duplicates'")
+	}
+
+	return Policy{
+		directives: withReportURI([]Directive{
+			{Name: "require-trusted-types-for", Values: []string{"'script'"}},
+			{Name: "trusted-types", Values: trustedTypes},
+		}, t.ReportURI),
+	}
+}
+
+// validTrustedTypesPolicyName reports whether name is a valid
+// tt-policy-name, as defined in
+// https://w3c.github.io/webappsec-trusted-types/dist/spec/#trusted-types-csp-directive
+func validTrustedTypesPolicyName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-#=_/@.%", c)) {
+			return false
+		}
 	}
+	return true
 }
 
 // Interceptor intercepts requests and applies CSP policies.
@@ -183,26 +221,254 @@ func Default(reportURI string) Interceptor {
 }
 
 // Before claims and sets the Content-Security-Policy header and the
-// Content-Security-Policy-Report-Only header.
-func (it Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+// Content-Security-Policy-Report-Only header. A Config can be passed to relax
+// the policies on a specific route.
+func (it Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	c, _ := cfg.(Config)
+
+	h := w.Header()
+	setCSP := h.Claim("Content-Security-Policy")
+	setCSPReportOnly := h.Claim("Content-Security-Policy-Report-Only")
+
+	if err := c.Validate(); err != nil {
+		return w.WriteError(safehttp.StatusInternalServerError)
+	}
+
 	nonce := generateNonce()
 	r.SetContext(context.WithValue(r.Context(), ctxKey{}, nonce))
 
-	var CSPs []string
+	if c.Disable {
+		return safehttp.Result{}
+	}
+
+	var CSPs, reportCSPs []string
+	add := func(p Policy, enforce bool) {
+		// Policies left without any restriction by the Config, e.g. framing
+		// policies on routes allowing framing, are dropped.
+		if p.empty() {
+			return
+		}
+		if enforce && !c.ReportOnly {
+			CSPs = append(CSPs, p.serialize(nonce))
+			return
+		}
+		reportCSPs = append(reportCSPs, p.serialize(nonce))
+	}
 	for _, p := range it.Enforce {
-		CSPs = append(CSPs, p.serialize(nonce))
+		p = p.relax(c)
+		if !c.ReportOnlyTrustedTypes {
+			add(p, true)
+			continue
+		}
+		types, rest := p.split(trustedTypesDirectives)
+		add(rest, true)
+		add(types, false)
 	}
-	var reportCSPs []string
 	for _, p := range it.ReportOnly {
-		reportCSPs = append(reportCSPs, p.serialize(nonce))
+		p = p.relax(c)
+		if !c.EnforceTrustedTypes {
+			add(p, false)
+			continue
+		}
+		types, rest := p.split(trustedTypesDirectives)
+		add(types, true)
+		add(rest, false)
 	}
 
-	h := w.Header()
-	setCSP := h.Claim("Content-Security-Policy")
-	setCSPReportOnly := h.Claim("Content-Security-Policy-Report-Only")
-
 	setCSP(CSPs)
 	setCSPReportOnly(reportCSPs)
 
 	return safehttp.Result{}
 }
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to relax the CSP
+// policies applied by the Interceptor on a specific route. The routes relaxing
+// the policies can be listed with Audit.
+type Config struct {
+	// Disable turns off CSP on the route, e.g. on legacy pages which can't be
+	// migrated. No Content-Security-Policy or
+	// Content-Security-Policy-Report-Only header will be set.
+	Disable bool
+	// ReportOnly sets all the policies in report-only mode, e.g. while
+	// migrating the route to a stricter policy.
+	ReportOnly bool
+	// Hashes adds a set of hashes to the script-src directive of the
+	// policies, e.g. for inline scripts which can't be given a nonce. Hashes
+	// are written like the ones of StrictCSPBuilder, e.g.
+	//  sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M=
+	// Only sha256, sha384 and sha512 hashes are allowed.
+	Hashes []string
+	// FramingAllowlist adds a set of origins, e.g. https://example.com, to the
+	// frame-ancestors directive of the policies, so that the route can be
+	// embedded by these origins on top of the ones allowed by the policies.
+	// Origins must be written as scheme://host[:port] and can't contain
+	// wildcards. Use AllowFraming to allow framing by any site.
+	FramingAllowlist []string
+	// AllowFraming removes the frame-ancestors directive from the policies,
+	// so that the route can be embedded by any other site. Policies left
+	// without any other directive, such as the ones created by
+	// FramingPolicyBuilder, aren't set at all.
+	AllowFraming bool
+	// ReportOnlyTrustedTypes sets the require-trusted-types-for and
+	// trusted-types directives of the enforced policies, such as the ones
+	// created by TrustedTypesBuilder, in a separate report-only policy, e.g.
+	// on routes that haven't been migrated to Trusted Types yet. The other
+	// directives of the policies are still enforced.
+	ReportOnlyTrustedTypes bool
+	// EnforceTrustedTypes enforces the require-trusted-types-for and
+	// trusted-types directives of the report-only policies, in a separate
+	// policy, e.g. in order to roll out Trusted Types route by route. The
+	// other directives of the policies are still report-only.
+	EnforceTrustedTypes bool
+}
+
+// Match returns true if the interceptor is a CSP Interceptor.
+func (Config) Match(i safehttp.Interceptor) bool {
+	switch i.(type) {
+	case Interceptor, *Interceptor:
+		return true
+	}
+	return false
+}
+
+// Validate returns an error if the Config contains invalid hashes or origins.
+// It's called by safehttp.ServeMux.Handle, which panics if the Config is
+// invalid.
+func (c Config) Validate() error {
+	for _, h := range c.Hashes {
+		if !validHash(h) {
+			return fmt.Errorf("invalid hash %q", h)
+		}
+	}
+	for _, o := range c.FramingAllowlist {
+		if !validOrigin(o) {
+			return fmt.Errorf("invalid origin %q", o)
+		}
+	}
+	return nil
+}
+
+// validOrigin reports whether o is a serialized origin, i.e.
+// scheme://host[:port], without wildcards.
+func validOrigin(o string) bool {
+	if !validSource(o) || strings.Contains(o, "*") {
+		return false
+	}
+	u, err := url.Parse(o)
+	if err != nil || u.Host == "" || u.Hostname() == "" || u.User != nil || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.Opaque != "" {
+		return false
+	}
+	return strings.HasSuffix(o, "://"+u.Host)
+}
+
+// relax returns a copy of the policy with the hashes of the Config added to
+// its script-src directive and the origins of the FramingAllowlist added to
+// its frame-ancestors directive, or without its frame-ancestors directive if
+// the Config allows framing. Directives set to 'none' are replaced.
+func (p Policy) relax(c Config) Policy {
+	if len(c.Hashes) == 0 && len(c.FramingAllowlist) == 0 && !c.AllowFraming {
+		return p
+	}
+	var hashes []string
+	for _, h := range c.Hashes {
+		hashes = append(hashes, "'"+h+"'")
+	}
+	var ds []Directive
+	for _, d := range p.Directives() {
+		var extra []string
+		switch d.Name {
+		case "script-src":
+			extra = hashes
+		case "frame-ancestors":
+			if c.AllowFraming {
+				continue
+			}
+			extra = c.FramingAllowlist
+		}
+		if len(extra) > 0 {
+			if len(d.Values) == 1 && strings.EqualFold(d.Values[0], "'none'") {
+				d.Values = nil
+			}
+			d.Values = append(d.Values, extra...)
+		}
+		ds = append(ds, d)
+	}
+	p.directives = ds
+	return p
+}
+
+// weakenings returns the ways in which the Config weakens the policies of the
+// Interceptor.
+func (c Config) weakenings() []string {
+	var w []string
+	if c.Disable {
+		w = append(w, "CSP disabled")
+	}
+	if c.ReportOnly {
+		w = append(w, "report-only")
+	}
+	if len(c.Hashes) > 0 {
+		w = append(w, fmt.Sprintf("script hashes %s", strings.Join(c.Hashes, " ")))
+	}
+	if c.AllowFraming {
+		w = append(w, "framing allowed")
+	}
+	if len(c.FramingAllowlist) > 0 {
+		w = append(w, fmt.Sprintf("framing allowed by %s", strings.Join(c.FramingAllowlist, " ")))
+	}
+	if c.ReportOnlyTrustedTypes {
+		w = append(w, "report-only Trusted Types")
+	}
+	return w
+}
+
+// WeakenedRoute is a route on which a Config weakens the CSP policies.
+type WeakenedRoute struct {
+	// Pattern is the pattern the route was registered with.
+	Pattern string
+	// Method is the HTTP method the route was registered with.
+	Method string
+	// Config is the Config passed to safehttp.ServeMux.Handle for the route.
+	Config Config
+	// Weakenings describes how the Config weakens the policies, e.g.
+	// "report-only" or "framing allowed by https://example.com".
+	Weakenings []string
+}
+
+// Audit returns the routes of the ServeMux on which the CSP policies are
+// weakened by a Config, e.g. because CSP is disabled, in report-only mode or
+// relaxed with hashes or framing origins. Audit can be used to review and keep
+// track of the routes that don't run the policies of the Interceptor as they
+// are.
+//
+// Audit only inspects the first Config of each route, which is the one applied
+// by the Interceptor.
+func Audit(m *safehttp.ServeMux) []WeakenedRoute {
+	var routes []WeakenedRoute
+	for _, rt := range m.Routes() {
+		for _, cfg := range rt.Configs {
+			c, ok := cfg.(Config)
+			if !ok {
+				continue
+			}
+			if w := c.weakenings(); len(w) > 0 {
+				routes = append(routes, WeakenedRoute{
+					Pattern:    rt.Pattern,
+					Method:     rt.Method,
+					Config:     c,
+					Weakenings: w,
+				})
+			}
+			break
+		}
+	}
+	return routes
+}
@@ -17,6 +17,7 @@ package csp
 import (
 	"context"
 	"errors"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -96,6 +97,24 @@ func TestSerialize(t *testing.T) {
 			policy:     FramingPolicyBuilder{ReportURI: "httsp://example.com/collector"}.Build(),
 			wantString: "frame-ancestors 'self'; report-uri httsp://example.com/collector",
 		},
+		{
+			name:       "TrustedTypes",
+			policy:     TrustedTypesBuilder{}.Build(),
+			wantString: "require-trusted-types-for 'script'; trusted-types 'none'",
+		},
+		{
+			name: "TrustedTypes with allowed policies",
+			policy: TrustedTypesBuilder{
+				AllowedPolicies: []string{"default", "goog#html"},
+				AllowDuplicates: true,
+			}.Build(),
+			wantString: "require-trusted-types-for 'script'; trusted-types default goog#html 'allow-duplicates'",
+		},
+		{
+			name:       "TrustedTypes with report-uri",
+			policy:     TrustedTypesBuilder{AllowedPolicies: []string{"app"}, ReportURI: "https://example.com/collector"}.Build(),
+			wantString: "require-trusted-types-for 'script'; trusted-types app; report-uri https://example.com/collector",
+		},
 	}
 
 	for _, tt := range tests {
@@ -169,7 +188,7 @@ func TestBefore(t *testing.T) {
 			rr := safehttptest.NewResponseRecorder()
 			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
 
-			tt.interceptor.Before(rr.ResponseWriter, req)
+			tt.interceptor.Before(rr.ResponseWriter, req, nil)
 
 			h := rr.Header()
 			if diff := cmp.Diff(tt.wantEnforcePolicy, h.Values("Content-Security-Policy"), cmpopts.EquateEmpty()); diff != "" {
@@ -191,6 +210,216 @@ func TestBefore(t *testing.T) {
 	}
 }
 
+func TestBeforeAllowFraming(t *testing.T) {
+	rr := safehttptest.NewResponseRecorder()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+
+	it := Interceptor{
+		Enforce:    []Policy{StrictCSPBuilder{}.Build(), FramingPolicyBuilder{}.Build()},
+		ReportOnly: []Policy{FramingPolicyBuilder{}.Build()},
+	}
+	it.Before(rr.ResponseWriter, req, Config{AllowFraming: true})
+
+	h := rr.Header()
+	wantEnforcePolicy := []string{
+		"object-src 'none'; script-src 'unsafe-inline' 'nonce-KSkpKSkpKSkpKSkpKSkpKSkpKSk=' 'strict-dynamic' https: http:; base-uri 'none'",
+	}
+	if diff := cmp.Diff(wantEnforcePolicy, h.Values("Content-Security-Policy")); diff != "" {
+		t.Errorf("h.Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{}, h.Values("Content-Security-Policy-Report-Only"), cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("h.Values(\"Content-Security-Policy-Report-Only\") mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBeforeMixedPolicies(t *testing.T) {
+	const nonce = "'nonce-KSkpKSkpKSkpKSkpKSkpKSkpKSk='"
+	mustParse := func(s string) Policy {
+		p, err := ParsePolicy(s)
+		if err != nil {
+			t.Fatalf("ParsePolicy(%q) got err: %v want: nil", s, err)
+		}
+		return p
+	}
+	mixed, err := Builder{
+		Directives: []Directive{
+			{Name: "script-src", Values: []string{NonceSource}},
+			{Name: "require-trusted-types-for", Values: []string{"'script'"}},
+			{Name: "trusted-types", Values: []string{"app"}},
+			{Name: "frame-ancestors", Values: []string{"'self'"}},
+		},
+		ReportURI: "/collector",
+	}.Build()
+	if err != nil {
+		t.Fatalf("Build() got err: %v want: nil", err)
+	}
+
+	tests := []struct {
+		name                 string
+		interceptor          Interceptor
+		cfg                  Config
+		wantEnforcePolicy    []string
+		wantReportOnlyPolicy []string
+	}{
+		{
+			name:              "Allow framing on parsed policy",
+			interceptor:       Interceptor{Enforce: []Policy{mustParse("object-src 'none'; script-src 'nonce'; frame-ancestors 'self'")}},
+			cfg:               Config{AllowFraming: true},
+			wantEnforcePolicy: []string{"object-src 'none'; script-src " + nonce},
+		},
+		{
+			name:                 "Allow framing on report-only policy",
+			interceptor:          Interceptor{ReportOnly: []Policy{mixed}},
+			cfg:                  Config{AllowFraming: true},
+			wantReportOnlyPolicy: []string{"script-src " + nonce + "; require-trusted-types-for 'script'; trusted-types app; report-uri /collector"},
+		},
+		{
+			name:                 "Allow framing with framing policy",
+			interceptor:          Interceptor{Enforce: []Policy{FramingPolicyBuilder{ReportURI: "/collector"}.Build()}},
+			cfg:                  Config{AllowFraming: true},
+			wantEnforcePolicy:    nil,
+			wantReportOnlyPolicy: nil,
+		},
+		{
+			name:                 "Report-only Trusted Types",
+			interceptor:          Interceptor{Enforce: []Policy{mixed}},
+			cfg:                  Config{ReportOnlyTrustedTypes: true},
+			wantEnforcePolicy:    []string{"script-src " + nonce + "; frame-ancestors 'self'; report-uri /collector"},
+			wantReportOnlyPolicy: []string{"require-trusted-types-for 'script'; trusted-types app; report-uri /collector"},
+		},
+		{
+			name:                 "Enforced Trusted Types",
+			interceptor:          Interceptor{ReportOnly: []Policy{mixed}},
+			cfg:                  Config{EnforceTrustedTypes: true},
+			wantEnforcePolicy:    []string{"require-trusted-types-for 'script'; trusted-types app; report-uri /collector"},
+			wantReportOnlyPolicy: []string{"script-src " + nonce + "; frame-ancestors 'self'; report-uri /collector"},
+		},
+		{
+			name:                 "Report-only Trusted Types and allow framing",
+			interceptor:          Interceptor{Enforce: []Policy{mixed}},
+			cfg:                  Config{ReportOnlyTrustedTypes: true, AllowFraming: true},
+			wantEnforcePolicy:    []string{"script-src " + nonce + "; report-uri /collector"},
+			wantReportOnlyPolicy: []string{"require-trusted-types-for 'script'; trusted-types app; report-uri /collector"},
+		},
+		{
+			name:                 "Report-only Trusted Types on parsed policy without Trusted Types",
+			interceptor:          Interceptor{Enforce: []Policy{mustParse("object-src 'none'; script-src 'nonce'")}},
+			cfg:                  Config{ReportOnlyTrustedTypes: true},
+			wantEnforcePolicy:    []string{"object-src 'none'; script-src " + nonce},
+			wantReportOnlyPolicy: nil,
+		},
+		{
+			name:                 "Report-only route with Trusted Types",
+			interceptor:          Interceptor{Enforce: []Policy{mixed}},
+			cfg:                  Config{ReportOnly: true, ReportOnlyTrustedTypes: true},
+			wantEnforcePolicy:    nil,
+			wantReportOnlyPolicy: []string{"script-src " + nonce + "; frame-ancestors 'self'; report-uri /collector", "require-trusted-types-for 'script'; trusted-types app; report-uri /collector"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+
+			tt.interceptor.Before(rr.ResponseWriter, req, tt.cfg)
+
+			h := rr.Header()
+			if diff := cmp.Diff(tt.wantEnforcePolicy, h.Values("Content-Security-Policy"), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("h.Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantReportOnlyPolicy, h.Values("Content-Security-Policy-Report-Only"), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("h.Values(\"Content-Security-Policy-Report-Only\") mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTrustedTypesBuilderInvalidPolicyName(t *testing.T) {
+	for _, name := range []string{"", "my policy", "'none'", "a;b"} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("TrustedTypesBuilder{AllowedPolicies: []string{%q}}.Build() expected panic", name)
+				}
+			}()
+			TrustedTypesBuilder{AllowedPolicies: []string{name}}.Build()
+		})
+	}
+}
+
+func TestBeforeTrustedTypesConfig(t *testing.T) {
+	const (
+		strict = "object-src 'none'; script-src 'unsafe-inline' 'nonce-KSkpKSkpKSkpKSkpKSkpKSkpKSk=' 'strict-dynamic' https: http:; base-uri 'none'"
+		types  = "require-trusted-types-for 'script'; trusted-types app"
+	)
+	tests := []struct {
+		name                 string
+		interceptor          Interceptor
+		cfg                  Config
+		wantEnforcePolicy    []string
+		wantReportOnlyPolicy []string
+	}{
+		{
+			name: "Enforced",
+			interceptor: Interceptor{
+				Enforce: []Policy{StrictCSPBuilder{}.Build(), TrustedTypesBuilder{AllowedPolicies: []string{"app"}}.Build()},
+			},
+			wantEnforcePolicy: []string{strict, types},
+		},
+		{
+			name: "Enforced with report-only route",
+			interceptor: Interceptor{
+				Enforce: []Policy{StrictCSPBuilder{}.Build(), TrustedTypesBuilder{AllowedPolicies: []string{"app"}}.Build()},
+			},
+			cfg:                  Config{ReportOnlyTrustedTypes: true},
+			wantEnforcePolicy:    []string{strict},
+			wantReportOnlyPolicy: []string{types},
+		},
+		{
+			name: "Report-only",
+			interceptor: Interceptor{
+				Enforce:    []Policy{StrictCSPBuilder{}.Build()},
+				ReportOnly: []Policy{TrustedTypesBuilder{AllowedPolicies: []string{"app"}}.Build()},
+			},
+			wantEnforcePolicy:    []string{strict},
+			wantReportOnlyPolicy: []string{types},
+		},
+		{
+			name: "Report-only with enforced route",
+			interceptor: Interceptor{
+				Enforce:    []Policy{StrictCSPBuilder{}.Build()},
+				ReportOnly: []Policy{TrustedTypesBuilder{AllowedPolicies: []string{"app"}}.Build()},
+			},
+			cfg:               Config{EnforceTrustedTypes: true},
+			wantEnforcePolicy: []string{strict, types},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+
+			tt.interceptor.Before(rr.ResponseWriter, req, tt.cfg)
+
+			h := rr.Header()
+			if diff := cmp.Diff(tt.wantEnforcePolicy, h.Values("Content-Security-Policy"), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("h.Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantReportOnlyPolicy, h.Values("Content-Security-Policy-Report-Only"), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("h.Values(\"Content-Security-Policy-Report-Only\") mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	if !(Config{}).Match(Default("")) {
+		t.Error(`Config{}.Match(Default("")) got: false want: true`)
+	}
+}
+
 type errorReader struct{}
 
 func (errorReader) Read(b []byte) (int, error) {
@@ -200,6 +429,7 @@ func (errorReader) Read(b []byte) (int, error) {
 func TestPanicWhileGeneratingNonce(t *testing.T) {
 	randReader = errorReader{}
 	defer func() {
+		randReader = endlessAReader{}
 		if r := recover(); r == nil {
 			t.Error("generateNonce() expected panic")
 		}
@@ -230,3 +460,202 @@ func TestNonceEmptyContext(t *testing.T) {
 		t.Errorf("Nonce(ctx) got nonce: %v want: %v", n, want)
 	}
 }
+
+func TestBeforeRouteConfig(t *testing.T) {
+	const (
+		strict  = "object-src 'none'; script-src 'unsafe-inline' 'nonce-KSkpKSkpKSkpKSkpKSkpKSkpKSk=' 'strict-dynamic' https: http:; base-uri 'none'"
+		framing = "frame-ancestors 'self'"
+		hash    = "sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M="
+	)
+	tests := []struct {
+		name             string
+		config           Config
+		wantEnforced     []string
+		wantReportedOnly []string
+	}{
+		{
+			name:         "No config",
+			wantEnforced: []string{strict, framing},
+		},
+		{
+			name:   "Hashes",
+			config: Config{Hashes: []string{hash}},
+			wantEnforced: []string{
+				"object-src 'none'; script-src 'unsafe-inline' 'nonce-KSkpKSkpKSkpKSkpKSkpKSkpKSk=' 'strict-dynamic' https: http: '" + hash + "'; base-uri 'none'",
+				framing,
+			},
+		},
+		{
+			name:         "Framing allowlist",
+			config:       Config{FramingAllowlist: []string{"https://example.com", "http://localhost:8080"}},
+			wantEnforced: []string{strict, "frame-ancestors 'self' https://example.com http://localhost:8080"},
+		},
+		{
+			name:             "Report only",
+			config:           Config{ReportOnly: true},
+			wantReportedOnly: []string{strict, framing},
+		},
+		{
+			name:   "Disable",
+			config: Config{Disable: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+
+			Default("").Before(rr.ResponseWriter, req, tt.config)
+
+			if got, want := rr.Status(), safehttp.StatusOK; got != want {
+				t.Errorf("rr.Status() got: %v want: %v", got, want)
+			}
+			h := rr.Header()
+			if diff := cmp.Diff(tt.wantEnforced, h.Values("Content-Security-Policy"), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("h.Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantReportedOnly, h.Values("Content-Security-Policy-Report-Only"), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("h.Values(\"Content-Security-Policy-Report-Only\") mismatch (-want +got):\n%s", diff)
+			}
+			if _, err := Nonce(req.Context()); err != nil {
+				t.Errorf("Nonce(req.Context()) got err: %v want: nil", err)
+			}
+		})
+	}
+}
+
+func TestBeforeFramingAllowlistReplacesNone(t *testing.T) {
+	p, err := Builder{Directives: []Directive{{Name: "frame-ancestors", Values: []string{"'none'"}}}}.Build()
+	if err != nil {
+		t.Fatalf("Build() got err: %v want: nil", err)
+	}
+	rr := safehttptest.NewResponseRecorder()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+
+	Interceptor{Enforce: []Policy{p}}.Before(rr.ResponseWriter, req, Config{FramingAllowlist: []string{"https://example.com"}})
+
+	want := []string{"frame-ancestors https://example.com"}
+	if diff := cmp.Diff(want, rr.Header().Values("Content-Security-Policy")); diff != "" {
+		t.Errorf("rr.Header().Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestBeforeInvalidRouteConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "Invalid hash", config: Config{Hashes: []string{"sha256-a b"}}},
+		{name: "Nonce as hash", config: Config{Hashes: []string{"nonce-abc"}}},
+		{name: "Keyword as hash", config: Config{Hashes: []string{"unsafe-eval"}}},
+		{name: "Unquoted keyword as hash", config: Config{Hashes: []string{"self"}}},
+		{name: "Unknown hash algorithm", config: Config{Hashes: []string{"md5-CihokcEcBW4atb/CW/XWsw=="}}},
+		{name: "Empty hash", config: Config{Hashes: []string{"sha256-"}}},
+		{name: "Keyword as origin", config: Config{FramingAllowlist: []string{"'self'"}}},
+		{name: "Invalid origin", config: Config{FramingAllowlist: []string{"https://exa mple.com"}}},
+		{name: "Wildcard origin", config: Config{FramingAllowlist: []string{"*"}}},
+		{name: "Wildcard host", config: Config{FramingAllowlist: []string{"https://*.example.com"}}},
+		{name: "Scheme only", config: Config{FramingAllowlist: []string{"https:"}}},
+		{name: "Host only", config: Config{FramingAllowlist: []string{"example.com"}}},
+		{name: "Origin with path", config: Config{FramingAllowlist: []string{"https://example.com/"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+
+			Default("").Before(rr.ResponseWriter, req, tt.config)
+
+			if got, want := rr.Status(), safehttp.StatusInternalServerError; got != want {
+				t.Errorf("rr.Status() got: %v want: %v", got, want)
+			}
+		})
+
+		t.Run(tt.name+" Handle", func(t *testing.T) {
+			mux := safehttp.NewServeMux(nil, "foo.com")
+			mux.Install(Default(""))
+			h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				return safehttp.NotWritten()
+			})
+
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("mux.Handle(%v) expected panic", tt.config)
+				}
+			}()
+			mux.Handle("/", safehttp.MethodGet, h, tt.config)
+		})
+	}
+}
+
+func TestAudit(t *testing.T) {
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(Default(""))
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	})
+	mux.Handle("/", safehttp.MethodGet, h)
+	mux.Handle("/strict", safehttp.MethodGet, h, Config{EnforceTrustedTypes: true})
+	mux.Handle("/legacy", safehttp.MethodGet, h, Config{Disable: true})
+	mux.Handle("/widget", safehttp.MethodGet, h, Config{FramingAllowlist: []string{"https://example.com"}, ReportOnly: true})
+
+	want := []WeakenedRoute{
+		{
+			Pattern:    "/legacy",
+			Method:     safehttp.MethodGet,
+			Config:     Config{Disable: true},
+			Weakenings: []string{"CSP disabled"},
+		},
+		{
+			Pattern:    "/widget",
+			Method:     safehttp.MethodGet,
+			Config:     Config{FramingAllowlist: []string{"https://example.com"}, ReportOnly: true},
+			Weakenings: []string{"report-only", "framing allowed by https://example.com"},
+		},
+	}
+	if diff := cmp.Diff(want, Audit(mux)); diff != "" {
+		t.Errorf("Audit(mux) mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAuditMatchesHeaders(t *testing.T) {
+	p, err := ParsePolicy("object-src 'none'; script-src 'nonce'; frame-ancestors 'self'; require-trusted-types-for 'script'; trusted-types app")
+	if err != nil {
+		t.Fatalf("ParsePolicy() got err: %v want: nil", err)
+	}
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(Interceptor{Enforce: []Policy{p}})
+	h := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return safehttp.NotWritten()
+	})
+	cfg := Config{AllowFraming: true, ReportOnlyTrustedTypes: true}
+	mux.Handle("/widget", safehttp.MethodGet, h, cfg)
+
+	want := []WeakenedRoute{
+		{
+			Pattern:    "/widget",
+			Method:     safehttp.MethodGet,
+			Config:     cfg,
+			Weakenings: []string{"framing allowed", "report-only Trusted Types"},
+		},
+	}
+	if diff := cmp.Diff(want, Audit(mux)); diff != "" {
+		t.Errorf("Audit(mux) mismatch (-want +got):\n%s", diff)
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(safehttp.MethodGet, "https://foo.com/widget", nil))
+
+	// The rest of the policy is still enforced, without frame-ancestors and
+	// with the Trusted Types directives in a separate report-only policy.
+	wantEnforced := []string{"object-src 'none'; script-src 'nonce-KSkpKSkpKSkpKSkpKSkpKSkpKSk='"}
+	if diff := cmp.Diff(wantEnforced, rec.Header().Values("Content-Security-Policy")); diff != "" {
+		t.Errorf("rec.Header().Values(\"Content-Security-Policy\") mismatch (-want +got):\n%s", diff)
+	}
+	wantReportOnly := []string{"require-trusted-types-for 'script'; trusted-types app"}
+	if diff := cmp.Diff(wantReportOnly, rec.Header().Values("Content-Security-Policy-Report-Only")); diff != "" {
+		t.Errorf("rec.Header().Values(\"Content-Security-Policy-Report-Only\") mismatch (-want +got):\n%s", diff)
+	}
+}
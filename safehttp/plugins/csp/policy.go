@@ -0,0 +1,503 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// NonceSource is a placeholder source expression that is replaced by the
+// nonce of the request, e.g. 'nonce-KSkpKSkp', when the policy is applied.
+// The nonce can be retrieved with Nonce.
+const NonceSource = "'nonce'"
+
+// Directive is a directive of a CSP policy, e.g. img-src 'self' https:.
+type Directive struct {
+	// Name is the name of the directive, e.g. "img-src".
+	Name string
+	// Values are the values of the directive, e.g. the source expressions
+	// "'self'" and "https:".
+	Values []string
+}
+
+// Builder can be used to create a CSP policy from arbitrary directives, e.g.
+//
+//	csp.Builder{
+//		Directives: []csp.Directive{
+//			{Name: "script-src", Values: []string{csp.NonceSource, "'strict-dynamic'"}},
+//			{Name: "img-src", Values: []string{"'self'", "https://images.example.com"}},
+//			{Name: "form-action", Values: []string{"'self'"}},
+//			{Name: "upgrade-insecure-requests"},
+//		},
+//	}.Build()
+//
+// See https://www.w3.org/TR/CSP3/#csp-directives for the list of directives.
+type Builder struct {
+	// Directives are the directives of the policy, in serialization order.
+	// Each directive can only be set once. Source expressions are validated,
+	// and nonces must be set with NonceSource rather than with a fixed value.
+	Directives []Directive
+	// ReportURI controls the report-uri directive. If ReportURI is empty, no
+	// report-uri directive will be set.
+	ReportURI string
+}
+
+// Build creates a Policy based on the specified directives. It returns an
+// error if a directive is unknown, is set multiple times or has invalid
+// values.
+func (b Builder) Build() (Policy, error) {
+	ds := withReportURI(b.Directives, b.ReportURI)
+	seen := map[string]bool{}
+	for _, d := range ds {
+		if !knownDirectives[d.Name] {
+			return Policy{}, fmt.Errorf("unknown directive %q", d.Name)
+		}
+		if seen[d.Name] {
+			return Policy{}, fmt.Errorf("duplicate directive %q", d.Name)
+		}
+		seen[d.Name] = true
+		if err := validateDirective(d); err != nil {
+			return Policy{}, err
+		}
+		for _, v := range d.Values {
+			if strings.HasPrefix(strings.ToLower(v), "'nonce-") {
+				return Policy{}, fmt.Errorf("directive %q: fixed nonce %s, use NonceSource instead", d.Name, v)
+			}
+		}
+	}
+	return newPolicy(ds), nil
+}
+
+// ParsePolicy parses a serialized CSP policy, e.g. the value of a
+// Content-Security-Policy header containing a single policy. Directive names
+// are converted to lower case and, as mandated by the CSP specification,
+// repeated directives are ignored. It returns an error if the policy is
+// malformed or contains invalid values. Nonces in the policy are kept as they
+// are.
+func ParsePolicy(s string) (Policy, error) {
+	if strings.Contains(s, ",") {
+		return Policy{}, errors.New("multiple policies can't be parsed at once")
+	}
+	var ds []Directive
+	seen := map[string]bool{}
+	for _, d := range strings.Split(s, ";") {
+		tokens := strings.Fields(d)
+		if len(tokens) == 0 {
+			continue
+		}
+		name := strings.ToLower(tokens[0])
+		if !validDirectiveName(name) {
+			return Policy{}, fmt.Errorf("invalid directive name %q", tokens[0])
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		dir := Directive{Name: name}
+		if len(tokens) > 1 {
+			dir.Values = tokens[1:]
+		}
+		if err := validateDirective(dir); err != nil {
+			return Policy{}, err
+		}
+		ds = append(ds, dir)
+	}
+	if len(ds) == 0 {
+		return Policy{}, errors.New("empty policy")
+	}
+	return newPolicy(ds), nil
+}
+
+func newPolicy(ds []Directive) Policy {
+	p := Policy{}
+	for _, d := range ds {
+		p.directives = append(p.directives, Directive{Name: d.Name, Values: append([]string(nil), d.Values...)})
+	}
+	return p
+}
+
+// withReportURI appends a report-uri directive to ds, if reportURI isn't
+// empty.
+func withReportURI(ds []Directive, reportURI string) []Directive {
+	if reportURI == "" {
+		return ds
+	}
+	return append(ds[:len(ds):len(ds)], Directive{Name: "report-uri", Values: []string{reportURI}})
+}
+
+// split splits the policy in two: the policy made of the directives whose
+// names are in names, and the policy made of the other directives. The
+// report-uri and report-to directives are kept in both policies, so that
+// violations of either policy are still reported.
+func (p Policy) split(names map[string]bool) (in, out Policy) {
+	for _, d := range p.Directives() {
+		switch {
+		case reportingDirectives[d.Name]:
+			in.directives = append(in.directives, d)
+			out.directives = append(out.directives, Directive{Name: d.Name, Values: append([]string(nil), d.Values...)})
+		case names[d.Name]:
+			in.directives = append(in.directives, d)
+		default:
+			out.directives = append(out.directives, d)
+		}
+	}
+	return in, out
+}
+
+// empty reports whether the policy has no directives restricting the page,
+// i.e. no directives other than report-uri and report-to.
+func (p Policy) empty() bool {
+	for _, d := range p.directives {
+		if !reportingDirectives[d.Name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Directives returns a copy of the directives of the policy.
+func (p Policy) Directives() []Directive {
+	ds := make([]Directive, 0, len(p.directives))
+	for _, d := range p.directives {
+		ds = append(ds, Directive{Name: d.Name, Values: append([]string(nil), d.Values...)})
+	}
+	return ds
+}
+
+// Directive returns the values of the directive with the given name. If the
+// policy doesn't contain the directive, ok is false.
+func (p Policy) Directive(name string) (values []string, ok bool) {
+	name = strings.ToLower(name)
+	for _, d := range p.directives {
+		if d.Name == name {
+			return append([]string(nil), d.Values...), true
+		}
+	}
+	return nil, false
+}
+
+// String serializes the policy, keeping NonceSource as is.
+func (p Policy) String() string {
+	return p.format(NonceSource)
+}
+
+// serialize serializes this policy for use in a Content-Security-Policy header
+// or in a Content-Security-Policy-Report-Only header, replacing NonceSource
+// with 'nonce-{nonce}'.
+func (p Policy) serialize(nonce string) string {
+	return p.format("'nonce-" + nonce + "'")
+}
+
+// format serializes this policy, replacing NonceSource with nonceSource.
+func (p Policy) format(nonceSource string) string {
+	var b strings.Builder
+	for i, d := range p.directives {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(d.Name)
+		for _, v := range d.Values {
+			if v == NonceSource {
+				v = nonceSource
+			}
+			b.WriteByte(' ')
+			b.WriteString(v)
+		}
+	}
+	return b.String()
+}
+
+var knownDirectives = map[string]bool{
+	"base-uri":                  true,
+	"block-all-mixed-content":   true,
+	"child-src":                 true,
+	"connect-src":               true,
+	"default-src":               true,
+	"fenced-frame-src":          true,
+	"font-src":                  true,
+	"form-action":               true,
+	"frame-ancestors":           true,
+	"frame-src":                 true,
+	"img-src":                   true,
+	"manifest-src":              true,
+	"media-src":                 true,
+	"object-src":                true,
+	"report-to":                 true,
+	"report-uri":                true,
+	"require-trusted-types-for": true,
+	"sandbox":                   true,
+	"script-src":                true,
+	"script-src-attr":           true,
+	"script-src-elem":           true,
+	"style-src":                 true,
+	"style-src-attr":            true,
+	"style-src-elem":            true,
+	"trusted-types":             true,
+	"upgrade-insecure-requests": true,
+	"worker-src":                true,
+}
+
+// reportingDirectives are the directives controlling where violations are
+// reported, rather than restricting the page.
+var reportingDirectives = map[string]bool{
+	"report-to":  true,
+	"report-uri": true,
+}
+
+// trustedTypesDirectives are the directives controlling Trusted Types.
+var trustedTypesDirectives = map[string]bool{
+	"require-trusted-types-for": true,
+	"trusted-types":             true,
+}
+
+// sourceListDirectives are the directives whose values are source
+// expressions.
+var sourceListDirectives = map[string]bool{
+	"base-uri":         true,
+	"child-src":        true,
+	"connect-src":      true,
+	"default-src":      true,
+	"fenced-frame-src": true,
+	"font-src":         true,
+	"form-action":      true,
+	"frame-ancestors":  true,
+	"frame-src":        true,
+	"img-src":          true,
+	"manifest-src":     true,
+	"media-src":        true,
+	"object-src":       true,
+	"script-src":       true,
+	"script-src-attr":  true,
+	"script-src-elem":  true,
+	"style-src":        true,
+	"style-src-attr":   true,
+	"style-src-elem":   true,
+	"worker-src":       true,
+}
+
+var keywordSources = map[string]bool{
+	"'none'":                   true,
+	"'self'":                   true,
+	"'unsafe-inline'":          true,
+	"'unsafe-eval'":            true,
+	"'strict-dynamic'":         true,
+	"'unsafe-hashes'":          true,
+	"'report-sample'":          true,
+	"'unsafe-allow-redirects'": true,
+	"'wasm-unsafe-eval'":       true,
+}
+
+var sandboxTokens = map[string]bool{
+	"allow-downloads":                          true,
+	"allow-forms":                              true,
+	"allow-modals":                             true,
+	"allow-orientation-lock":                   true,
+	"allow-pointer-lock":                       true,
+	"allow-popups":                             true,
+	"allow-popups-to-escape-sandbox":           true,
+	"allow-presentation":                       true,
+	"allow-same-origin":                        true,
+	"allow-scripts":                            true,
+	"allow-storage-access-by-user-activation":  true,
+	"allow-top-navigation":                     true,
+	"allow-top-navigation-by-user-activation":  true,
+	"allow-top-navigation-to-custom-protocols": true,
+}
+
+func validDirectiveName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validateDirective returns an error if the values of the directive are
+// invalid. Unknown directives are only checked for characters that can't
+// appear in a directive value.
+func validateDirective(d Directive) error {
+	if !validDirectiveName(d.Name) {
+		return fmt.Errorf("invalid directive name %q", d.Name)
+	}
+	for _, v := range d.Values {
+		if v == "" || strings.ContainsAny(v, " \t\r\n\f;,") {
+			return fmt.Errorf("directive %q: invalid value %q", d.Name, v)
+		}
+	}
+
+	switch {
+	case sourceListDirectives[d.Name]:
+		if len(d.Values) == 0 {
+			return fmt.Errorf("directive %q: empty source list, use 'none' instead", d.Name)
+		}
+		for _, v := range d.Values {
+			if strings.EqualFold(v, "'none'") && len(d.Values) > 1 {
+				return fmt.Errorf("directive %q: 'none' can't be combined with other sources", d.Name)
+			}
+			if !validSource(v) {
+				return fmt.Errorf("directive %q: invalid source expression %q", d.Name, v)
+			}
+		}
+	case d.Name == "upgrade-insecure-requests" || d.Name == "block-all-mixed-content":
+		if len(d.Values) != 0 {
+			return fmt.Errorf("directive %q doesn't take values", d.Name)
+		}
+	case d.Name == "sandbox":
+		for _, v := range d.Values {
+			if !sandboxTokens[strings.ToLower(v)] {
+				return fmt.Errorf("directive %q: invalid token %q", d.Name, v)
+			}
+		}
+	case d.Name == "report-uri":
+		if len(d.Values) == 0 {
+			return fmt.Errorf("directive %q: missing URI", d.Name)
+		}
+	case d.Name == "report-to":
+		if len(d.Values) != 1 {
+			return fmt.Errorf("directive %q: want a single endpoint name", d.Name)
+		}
+	case d.Name == "require-trusted-types-for":
+		if len(d.Values) != 1 || d.Values[0] != "'script'" {
+			return fmt.Errorf("directive %q: want 'script'", d.Name)
+		}
+	case d.Name == "trusted-types":
+		for _, v := range d.Values {
+			switch v {
+			case "'none'", "'allow-duplicates'", "*":
+				continue
+			}
+			if !validTrustedTypesPolicyName(v) {
+				return fmt.Errorf("directive %q: invalid policy name %q", d.Name, v)
+			}
+		}
+	}
+	return nil
+}
+
+// validSource reports whether s is a valid source expression, as defined in
+// https://www.w3.org/TR/CSP3/#framework-directive-source-list, or
+// NonceSource.
+func validSource(s string) bool {
+	ls := strings.ToLower(s)
+	switch {
+	case s == NonceSource || keywordSources[ls] || s == "*":
+		return true
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return false
+		}
+		inner := s[1 : len(s)-1]
+		i := strings.Index(inner, "-")
+		if i < 0 {
+			return false
+		}
+		if strings.EqualFold(inner[:i], "nonce") {
+			return validBase64(inner[i+1:])
+		}
+		return validHash(inner)
+	}
+
+	// scheme-source, e.g. https:
+	if i := strings.Index(s, ":"); i > 0 && i == len(s)-1 {
+		return validScheme(s[:i])
+	}
+
+	// Keywords without quotes are valid host-sources, but are almost always a
+	// mistake.
+	if keywordSources["'"+ls+"'"] {
+		return false
+	}
+
+	// host-source, e.g. https://*.example.com:443/path
+	rest := s
+	if i := strings.Index(rest, "://"); i >= 0 {
+		if !validScheme(rest[:i]) {
+			return false
+		}
+		rest = rest[i+3:]
+	}
+	host, path := rest, ""
+	if i := strings.Index(rest, "/"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		port := host[i+1:]
+		host = host[:i]
+		if port != "*" && !allRunes(port, func(c rune) bool { return c >= '0' && c <= '9' }) {
+			return false
+		}
+	}
+	if host != "*" {
+		host = strings.TrimPrefix(host, "*.")
+		for _, label := range strings.Split(host, ".") {
+			if !allRunes(label, func(c rune) bool {
+				return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-'
+			}) {
+				return false
+			}
+		}
+	}
+	return !strings.ContainsAny(path, "'\"")
+}
+
+func validScheme(scheme string) bool {
+	if scheme == "" || !(scheme[0] >= 'a' && scheme[0] <= 'z' || scheme[0] >= 'A' && scheme[0] <= 'Z') {
+		return false
+	}
+	return allRunes(scheme, func(c rune) bool {
+		return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.'
+	})
+}
+
+// validHash reports whether h is a hash source without quotes, e.g.
+// sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M=.
+func validHash(h string) bool {
+	i := strings.Index(h, "-")
+	if i < 0 {
+		return false
+	}
+	switch strings.ToLower(h[:i]) {
+	case "sha256", "sha384", "sha512":
+		return validBase64(h[i+1:])
+	}
+	return false
+}
+
+func validBase64(s string) bool {
+	s = strings.TrimRight(s, "=")
+	return allRunes(s, func(c rune) bool {
+		return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("+/-_", c)
+	})
+}
+
+// allRunes reports whether s is non-empty and f returns true for all its
+// runes.
+func allRunes(s string, f func(rune) bool) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !f(c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package csp
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestBuilder(t *testing.T) {
+	tests := []struct {
+		name       string
+		builder    Builder
+		wantString string
+	}{
+		{
+			name: "Fetch directives",
+			builder: Builder{
+				Directives: []Directive{
+					{Name: "default-src", Values: []string{"'self'"}},
+					{Name: "img-src", Values: []string{"'self'", "data:", "https://*.example.com:443/images/"}},
+					{Name: "connect-src", Values: []string{"https://api.example.com", "wss:"}},
+					{Name: "frame-src", Values: []string{"'none'"}},
+				},
+			},
+			wantString: "default-src 'self'; img-src 'self' data: https://*.example.com:443/images/; connect-src https://api.example.com wss:; frame-src 'none'",
+		},
+		{
+			name: "Nonce and hashes",
+			builder: Builder{
+				Directives: []Directive{
+					{Name: "script-src", Values: []string{NonceSource, "'strict-dynamic'", "'sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M='"}},
+				},
+			},
+			wantString: "script-src 'nonce-super-secret' 'strict-dynamic' 'sha256-CihokcEcBW4atb/CW/XWsvWwbTjqwQlE9nj9ii5ww5M='",
+		},
+		{
+			name: "Directives without sources",
+			builder: Builder{
+				Directives: []Directive{
+					{Name: "form-action", Values: []string{"'self'"}},
+					{Name: "upgrade-insecure-requests"},
+					{Name: "sandbox", Values: []string{"allow-scripts", "allow-forms"}},
+					{Name: "report-to", Values: []string{"csp-endpoint"}},
+				},
+			},
+			wantString: "form-action 'self'; upgrade-insecure-requests; sandbox allow-scripts allow-forms; report-to csp-endpoint",
+		},
+		{
+			name: "Report URI",
+			builder: Builder{
+				Directives: []Directive{{Name: "object-src", Values: []string{"'none'"}}},
+				ReportURI:  "https://example.com/collector",
+			},
+			wantString: "object-src 'none'; report-uri https://example.com/collector",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.builder.Build()
+			if err != nil {
+				t.Fatalf("tt.builder.Build() got err: %v want: nil", err)
+			}
+			if got := p.serialize("super-secret"); got != tt.wantString {
+				t.Errorf("p.serialize() got: %q want: %q", got, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestBuilderInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		directives []Directive
+	}{
+		{name: "Unknown directive", directives: []Directive{{Name: "foo-src", Values: []string{"'self'"}}}},
+		{name: "Upper case directive", directives: []Directive{{Name: "IMG-SRC", Values: []string{"'self'"}}}},
+		{name: "Duplicate directive", directives: []Directive{{Name: "img-src", Values: []string{"'self'"}}, {Name: "img-src", Values: []string{"data:"}}}},
+		{name: "Empty source list", directives: []Directive{{Name: "img-src"}}},
+		{name: "None with other sources", directives: []Directive{{Name: "img-src", Values: []string{"'none'", "'self'"}}}},
+		{name: "Unquoted keyword", directives: []Directive{{Name: "img-src", Values: []string{"self"}}}},
+		{name: "Unknown keyword", directives: []Directive{{Name: "script-src", Values: []string{"'unsafe-everything'"}}}},
+		{name: "Fixed nonce", directives: []Directive{{Name: "script-src", Values: []string{"'nonce-abc'"}}}},
+		{name: "Invalid hash", directives: []Directive{{Name: "script-src", Values: []string{"'sha256-a%b'"}}}},
+		{name: "Unknown hash algorithm", directives: []Directive{{Name: "script-src", Values: []string{"'md5-abc'"}}}},
+		{name: "Whitespace in value", directives: []Directive{{Name: "img-src", Values: []string{"'self' data:"}}}},
+		{name: "Semicolon in value", directives: []Directive{{Name: "img-src", Values: []string{"'self';script-src"}}}},
+		{name: "Comma in value", directives: []Directive{{Name: "img-src", Values: []string{"'self',"}}}},
+		{name: "Invalid host", directives: []Directive{{Name: "img-src", Values: []string{"https://exa_mple.com"}}}},
+		{name: "Invalid port", directives: []Directive{{Name: "img-src", Values: []string{"https://example.com:http"}}}},
+		{name: "Invalid scheme", directives: []Directive{{Name: "img-src", Values: []string{"1http:"}}}},
+		{name: "Values on upgrade-insecure-requests", directives: []Directive{{Name: "upgrade-insecure-requests", Values: []string{"'self'"}}}},
+		{name: "Unknown sandbox token", directives: []Directive{{Name: "sandbox", Values: []string{"allow-everything"}}}},
+		{name: "Multiple report-to endpoints", directives: []Directive{{Name: "report-to", Values: []string{"a", "b"}}}},
+		{name: "Invalid require-trusted-types-for", directives: []Directive{{Name: "require-trusted-types-for", Values: []string{"'style'"}}}},
+		{name: "Invalid trusted types policy", directives: []Directive{{Name: "trusted-types", Values: []string{"a$b"}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (Builder{Directives: tt.directives}).Build(); err == nil {
+				t.Errorf("Builder{Directives: %v}.Build() got err: nil want: error", tt.directives)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name           string
+		policy         string
+		wantDirectives []Directive
+		wantString     string
+	}{
+		{
+			name:   "Strict CSP",
+			policy: "object-src 'none'; script-src 'unsafe-inline' 'nonce-KSkp' 'strict-dynamic' https: http:; base-uri 'none'",
+			wantDirectives: []Directive{
+				{Name: "object-src", Values: []string{"'none'"}},
+				{Name: "script-src", Values: []string{"'unsafe-inline'", "'nonce-KSkp'", "'strict-dynamic'", "https:", "http:"}},
+				{Name: "base-uri", Values: []string{"'none'"}},
+			},
+			wantString: "object-src 'none'; script-src 'unsafe-inline' 'nonce-KSkp' 'strict-dynamic' https: http:; base-uri 'none'",
+		},
+		{
+			name:   "Whitespace and case",
+			policy: "  IMG-SRC   'self'\tdata: ;; upgrade-insecure-requests ;",
+			wantDirectives: []Directive{
+				{Name: "img-src", Values: []string{"'self'", "data:"}},
+				{Name: "upgrade-insecure-requests"},
+			},
+			wantString: "img-src 'self' data:; upgrade-insecure-requests",
+		},
+		{
+			name:   "Duplicate directives are ignored",
+			policy: "img-src 'self'; img-src *",
+			wantDirectives: []Directive{
+				{Name: "img-src", Values: []string{"'self'"}},
+			},
+			wantString: "img-src 'self'",
+		},
+		{
+			name:   "Unknown directives are kept",
+			policy: "navigate-to 'self'; frame-ancestors 'none'",
+			wantDirectives: []Directive{
+				{Name: "navigate-to", Values: []string{"'self'"}},
+				{Name: "frame-ancestors", Values: []string{"'none'"}},
+			},
+			wantString: "navigate-to 'self'; frame-ancestors 'none'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy(tt.policy)
+			if err != nil {
+				t.Fatalf("ParsePolicy(%q) got err: %v want: nil", tt.policy, err)
+			}
+			if diff := cmp.Diff(tt.wantDirectives, p.Directives(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("p.Directives() mismatch (-want +got):\n%s", diff)
+			}
+			if got := p.String(); got != tt.wantString {
+				t.Errorf("p.String() got: %q want: %q", got, tt.wantString)
+			}
+		})
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		" ; ",
+		"img-src 'self', script-src 'none'",
+		"img_src 'self'",
+		"img-src 'self' 'bogus'",
+		"img-src 'none' 'self'",
+		"img-src",
+		"upgrade-insecure-requests 'self'",
+	}
+
+	for _, policy := range tests {
+		t.Run(policy, func(t *testing.T) {
+			if _, err := ParsePolicy(policy); err == nil {
+				t.Errorf("ParsePolicy(%q) got err: nil want: error", policy)
+			}
+		})
+	}
+}
+
+func TestParsePolicyRoundTrip(t *testing.T) {
+	policies := []Policy{
+		StrictCSPBuilder{NoStrictDynamic: true, UnsafeEval: true, BaseURI: "https://example.com", ReportURI: "https://example.com/collector"}.Build(),
+		FramingPolicyBuilder{ReportURI: "https://example.com/collector"}.Build(),
+		TrustedTypesBuilder{AllowedPolicies: []string{"foo", "bar"}, AllowDuplicates: true}.Build(),
+	}
+
+	for _, p := range policies {
+		t.Run(p.String(), func(t *testing.T) {
+			got, err := ParsePolicy(p.String())
+			if err != nil {
+				t.Fatalf("ParsePolicy(%q) got err: %v want: nil", p.String(), err)
+			}
+			if diff := cmp.Diff(p.Directives(), got.Directives(), cmpopts.EquateEmpty()); diff != "" {
+				t.Errorf("ParsePolicy(p.String()).Directives() mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPolicyDirective(t *testing.T) {
+	p := StrictCSPBuilder{}.Build()
+
+	got, ok := p.Directive("Script-Src")
+	if !ok {
+		t.Fatal(`p.Directive("Script-Src") got ok: false want: true`)
+	}
+	want := []string{"'unsafe-inline'", NonceSource, "'strict-dynamic'", "https:", "http:"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf(`p.Directive("Script-Src") mismatch (-want +got):\n%s`, diff)
+	}
+
+	got[0] = "'self'"
+	if v, _ := p.Directive("script-src"); v[0] != "'unsafe-inline'" {
+		t.Errorf("modifying the returned values changed the policy, got: %q", v[0])
+	}
+
+	if _, ok := p.Directive("img-src"); ok {
+		t.Error(`p.Directive("img-src") got ok: true want: false`)
+	}
+}
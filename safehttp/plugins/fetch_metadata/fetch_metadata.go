@@ -16,6 +16,7 @@ package fetchmetadata
 
 import (
 	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/cors"
 )
 
 // RequestLogger is used for logging Fetch Metadata policy violations;
@@ -63,7 +64,8 @@ type Plugin struct {
 // NewPlugin creates a new Fetch Metadata plugin in enforce mode that will apply
 // the Resource Isolation Policy by default. The user can provide a set of
 // endpoints that are CORS-protected. Any request targeted to those endpoints
-// will be allowed by default without the policies being applied.
+// will be allowed by default without the policies being applied. Passing a
+// Config to safehttp.ServeMux.Handle achieves the same on a specific route.
 func NewPlugin(endpoints ...string) *Plugin {
 	m := map[string]bool{}
 	for _, e := range endpoints {
@@ -128,14 +130,21 @@ func (p *Plugin) SetEnforce() {
 // Before validates the safehttp.IncomingRequest using the Resource Isolation
 // Policy and, if enabled, the Navigation Isolation Policy. It only allows
 // requests to pass if they conform to the policy, if it's targeted to one of
-// the CORS-protected endpoints, specified when creating the plugin, or if the
-// mode is set to  "report", in which case the request is allowed to pass but
-// the  violation is reported. If a redirectURL was provided and the Navigation
-// Isolation Policy is enabled and fails, the IncomingRequest will be
-// redirected to redirectURL.
-func (p *Plugin) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
-	// TODO(mihalimara22): Remove and disable using configurations when those
-	// have been implemented
+// the CORS-protected endpoints, specified when creating the plugin, if the
+// route was registered with a Config allowing cross-site requests, if it's a
+// cross-origin request allowed by the CORS Interceptor, which must then be
+// installed before the Plugin, or if the mode is set to "report", in which
+// case the request is allowed to pass but the violation is reported. If a
+// redirectURL was provided and the Navigation Isolation Policy is enabled and
+// fails, the IncomingRequest will be redirected to redirectURL.
+func (p *Plugin) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	if c, ok := cfg.(Config); ok && c.AllowCrossSite {
+		return safehttp.Result{}
+	}
+	if cors.Allowed(r) {
+		// The CORS Interceptor allowed the request based on its Origin.
+		return safehttp.Result{}
+	}
 	if p.corsProtected[r.URL.Path()] {
 		// The request is targeted to an endpoint on which Fetch Metadata
 		// policies are disabled because it is CORS-protected so we don't apply
@@ -163,3 +172,26 @@ func (p *Plugin) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest)
 
 	return safehttp.Result{}
 }
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (p *Plugin) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (p *Plugin) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to change the
+// behavior of the Plugin on a specific route.
+type Config struct {
+	// AllowCrossSite disables both the Resource and the Navigation Isolation
+	// Policies on the route, e.g. because it is CORS-protected or meant to be
+	// embedded by other sites.
+	AllowCrossSite bool
+}
+
+// Match returns true if the interceptor is a Fetch Metadata Plugin.
+func (Config) Match(i safehttp.Interceptor) bool {
+	_, ok := i.(*Plugin)
+	return ok
+}
@@ -168,7 +168,7 @@ func TestAllowedResourceIsolationEnforceMode(t *testing.T) {
 			rec := safehttptest.NewResponseRecorder()
 
 			p := fetchmetadata.NewPlugin()
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusOK, safehttp.StatusCode(rec.Status()); got != want {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -194,7 +194,7 @@ func TestRejectedResourceIsolationEnforceMode(t *testing.T) {
 			rec := safehttptest.NewResponseRecorder()
 
 			p := fetchmetadata.NewPlugin()
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusForbidden, safehttp.StatusCode(rec.Status()); want != got {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -248,7 +248,7 @@ func TestRejectedResourceIsolationEnforceModeWithLogger(t *testing.T) {
 			p := fetchmetadata.NewPlugin()
 			logger := &methodLogger{}
 			p.Logger = logger
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusForbidden, safehttp.StatusCode(rec.Status()); want != got {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -304,7 +304,7 @@ func TestResourceIsolationReportMode(t *testing.T) {
 			logger := &methodLogger{}
 			p.Logger = logger
 			p.SetReportOnly()
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusOK, safehttp.StatusCode(rec.Status()); got != want {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -344,7 +344,7 @@ func TestNavIsolationEnforceMode(t *testing.T) {
 
 			p := fetchmetadata.NewPlugin()
 			p.NavIsolation = true
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusForbidden, safehttp.StatusCode(rec.Status()); want != got {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -401,7 +401,7 @@ func TestNavIsolationReportMode(t *testing.T) {
 			p.Logger = logger
 			p.NavIsolation = true
 			p.SetReportOnly()
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusOK, safehttp.StatusCode(rec.Status()); want != got {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -430,7 +430,7 @@ func TestCORSEndpoint(t *testing.T) {
 			rec := safehttptest.NewResponseRecorder()
 
 			p := fetchmetadata.NewPlugin("/carbonara")
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusOK, safehttp.StatusCode(rec.Status()); got != want {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -498,7 +498,7 @@ func TestCORSAfterRedirect(t *testing.T) {
 			p := fetchmetadata.NewPlugin("/carbonara")
 			p.NavIsolation = true
 			p.RedirectURL, _ = safehttp.ParseURL("https://spaghetti.com/carbonara")
-			p.Before(rec.ResponseWriter, req)
+			p.Before(rec.ResponseWriter, req, nil)
 
 			if want, got := safehttp.StatusMovedPermanently, safehttp.StatusCode(rec.Status()); got != want {
 				t.Errorf("status code got: %v want: %v", got, want)
@@ -513,3 +513,33 @@ func TestCORSAfterRedirect(t *testing.T) {
 	}
 
 }
+
+func TestAllowCrossSiteConfig(t *testing.T) {
+	tests := append(disallowedRIPHeaders, disallowedRIPNavHeaders...)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(test.method, "https://spaghetti.com/carbonara", nil)
+			req.Header.Add("Sec-Fetch-Site", test.site)
+			req.Header.Add("Sec-Fetch-Mode", test.mode)
+			req.Header.Add("Sec-Fetch-Dest", test.dest)
+			rec := safehttptest.NewResponseRecorder()
+
+			p := fetchmetadata.NewPlugin()
+			p.NavIsolation = true
+			p.Before(rec.ResponseWriter, req, fetchmetadata.Config{AllowCrossSite: true})
+
+			if want, got := safehttp.StatusOK, safehttp.StatusCode(rec.Status()); got != want {
+				t.Errorf("status code got: %v want: %v", got, want)
+			}
+			if want, got := "", rec.Body(); got != want {
+				t.Errorf("response body got: %q want: %q", got, want)
+			}
+		})
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	if !(fetchmetadata.Config{}).Match(fetchmetadata.NewPlugin()) {
+		t.Error("fetchmetadata.Config{}.Match(fetchmetadata.NewPlugin()) got: false want: true")
+	}
+}
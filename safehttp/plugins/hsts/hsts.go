@@ -49,6 +49,10 @@ type Interceptor struct {
 	// traffic then this should be enabled. If this is enabled
 	// then the plugin will always send the Strict-Transport-Security
 	// header and will not redirect HTTP traffic to HTTPS traffic.
+	//
+	// Deprecated: the scheme reported by trusted proxies is used to detect
+	// HTTPS traffic, configure them with safehttp.ServeMux.SetTrustedProxies
+	// instead.
 	BehindProxy bool
 }
 
@@ -62,20 +66,30 @@ func Default() Interceptor {
 }
 
 // Before should be executed before the request is sent to the handler.
-// The function redirects HTTP requests to HTTPS. When HTTPS traffic
-// is received the Strict-Transport-Security header is applied to the
-// response.
-func (it Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfgs interface{}) safehttp.Result {
+// The function redirects HTTP requests to HTTPS, unless the route was
+// registered with a Config allowing HTTP. When HTTPS traffic is received the
+// Strict-Transport-Security header is applied to the response. Requests
+// received from trusted proxies are considered HTTPS traffic if the proxy
+// received them over HTTPS, see safehttp.IncomingRequest.Scheme.
+func (it Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	c, _ := cfg.(Config)
+
 	if it.MaxAge < 0 {
 		return w.WriteError(safehttp.StatusInternalServerError)
 	}
 
-	if !it.BehindProxy && r.TLS == nil {
+	if !it.BehindProxy && r.Scheme() != "https" {
+		if c.AllowHTTP {
+			return safehttp.NotWritten()
+		}
 		u, err := url.Parse(r.URL.String())
 		if err != nil {
 			return w.WriteError(safehttp.StatusInternalServerError)
 		}
 		u.Scheme = "https"
+		if u.Host == "" {
+			u.Host = r.Host()
+		}
 		return w.Redirect(r, u.String(), safehttp.StatusMovedPermanently)
 	}
 
@@ -92,3 +106,29 @@ func (it Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingReq
 	set([]string{value.String()})
 	return safehttp.NotWritten()
 }
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (it Interceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to change the
+// behavior of the Interceptor on a specific route.
+type Config struct {
+	// AllowHTTP disables the redirection of HTTP requests to HTTPS on the
+	// route, e.g. for health checks performed by a load balancer over HTTP.
+	// The Strict-Transport-Security header is still set on HTTPS responses.
+	AllowHTTP bool
+}
+
+// Match returns true if the interceptor is an HSTS Interceptor.
+func (Config) Match(i safehttp.Interceptor) bool {
+	switch i.(type) {
+	case Interceptor, *Interceptor:
+		return true
+	}
+	return false
+}
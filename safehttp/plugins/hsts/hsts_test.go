@@ -15,6 +15,7 @@
 package hsts_test
 
 import (
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -141,3 +142,69 @@ func TestHSTS(t *testing.T) {
 		})
 	}
 }
+
+func TestHSTSTrustedProxy(t *testing.T) {
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.SetTrustedProxies("10.0.0.0/8")
+	mux.Install(hsts.Default())
+	mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.NoContent()
+	}))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		wantStatus int
+		wantHSTS   string
+	}{
+		{
+			name:       "Trusted proxy",
+			remoteAddr: "10.0.0.1:1234",
+			wantStatus: int(safehttp.StatusNoContent),
+			wantHSTS:   "max-age=63072000; includeSubDomains",
+		},
+		{
+			name:       "Untrusted peer",
+			remoteAddr: "192.0.2.1:1234",
+			wantStatus: int(safehttp.StatusMovedPermanently),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := httptest.NewRecorder()
+
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("rec.Code got: %v want: %v", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Strict-Transport-Security"); got != tt.wantHSTS {
+				t.Errorf(`rec.Header().Get("Strict-Transport-Security") got: %q want: %q`, got, tt.wantHSTS)
+			}
+		})
+	}
+}
+
+func TestAllowHTTPConfig(t *testing.T) {
+	rr := safehttptest.NewResponseRecorder()
+	req := safehttptest.NewRequest(safehttp.MethodGet, "http://localhost/healthz", nil)
+
+	hsts.Default().Before(rr.ResponseWriter, req, hsts.Config{AllowHTTP: true})
+
+	if want := safehttp.StatusOK; rr.Status() != want {
+		t.Errorf("status code got: %v want: %v", rr.Status(), want)
+	}
+	if diff := cmp.Diff(map[string][]string{}, map[string][]string(rr.Header())); diff != "" {
+		t.Errorf("rr.Header() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	if !(hsts.Config{}).Match(hsts.Default()) {
+		t.Error("hsts.Config{}.Match(hsts.Default()) got: false want: true")
+	}
+}
@@ -24,12 +24,44 @@ type Plugin struct{}
 // Before claims and sets the following headers:
 //  - X-Content-Type-Options: nosniff
 //  - X-XSS-Protection: 0
+// The X-Content-Type-Options header is left unset on routes registered with a
+// Config allowing content sniffing.
 func (Plugin) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	c, _ := cfg.(Config)
+
 	h := w.Header()
 	setXCTO := h.Claim("X-Content-Type-Options")
 	setXXP := h.Claim("X-XSS-Protection")
 
-	setXCTO([]string{"nosniff"})
+	if !c.AllowSniffing {
+		setXCTO([]string{"nosniff"})
+	}
 	setXXP([]string{"0"})
 	return safehttp.NotWritten()
 }
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Plugin) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (Plugin) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to change the
+// behavior of the Plugin on a specific route.
+type Config struct {
+	// AllowSniffing disables the X-Content-Type-Options header on the route so
+	// that browsers can sniff the content type of legacy resources served with
+	// an incorrect Content-Type. The header stays claimed.
+	AllowSniffing bool
+}
+
+// Match returns true if the interceptor is a static headers Plugin.
+func (Config) Match(i safehttp.Interceptor) bool {
+	switch i.(type) {
+	case Plugin, *Plugin:
+		return true
+	}
+	return false
+}
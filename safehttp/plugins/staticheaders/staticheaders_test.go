@@ -46,3 +46,28 @@ func TestPlugin(t *testing.T) {
 		t.Errorf("rr.Body() got: %q want: %q", got, want)
 	}
 }
+
+func TestPluginAllowSniffing(t *testing.T) {
+	req := safehttptest.NewRequest(safehttp.MethodGet, "/", nil)
+	rr := safehttptest.NewResponseRecorder()
+
+	p := staticheaders.Plugin{}
+	p.Before(rr.ResponseWriter, req, staticheaders.Config{AllowSniffing: true})
+
+	wantHeaders := map[string][]string{
+		"X-Xss-Protection": {"0"},
+	}
+	if diff := cmp.Diff(wantHeaders, map[string][]string(rr.Header())); diff != "" {
+		t.Errorf("rr.Header() mismatch (-want +got):\n%s", diff)
+	}
+
+	if !rr.ResponseWriter.Header().IsClaimed("X-Content-Type-Options") {
+		t.Error(`rr.ResponseWriter.Header().IsClaimed("X-Content-Type-Options") got: false want: true`)
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	if !(staticheaders.Config{}).Match(staticheaders.Plugin{}) {
+		t.Error("staticheaders.Config{}.Match(staticheaders.Plugin{}) got: false want: true")
+	}
+}
@@ -26,6 +26,11 @@ const (
 	// TokenKey is the form key used when sending the token as part of POST
 	// request.
 	TokenKey = "xsrf-token"
+
+	// maxMemory is the maximum number of bytes of multipart forms stored in
+	// main memory, the rest being stored on disk. The total size of the
+	// forms is limited by the maximum body size of the safehttp.ServeMux.
+	maxMemory = 32 << 20
 )
 
 var statePreservingMethods = map[string]bool{
@@ -74,21 +79,34 @@ func Token(r *safehttp.IncomingRequest) (string, error) {
 //
 // For authorized requests, it adds a cryptographically safe XSRF token to the
 // incoming request. It can be later extracted using Token.
+//
+// Routes registered with a Config exempting them from XSRF protection are
+// neither checked nor provided with a token.
 func (i *Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) safehttp.Result {
+	if c, ok := cfg.(Config); ok && c.Exempt {
+		return safehttp.NotWritten()
+	}
+
 	userID, err := i.Identifier.UserID(r)
 	if err != nil {
 		return w.WriteError(safehttp.StatusUnauthorized)
 	}
 
-	actionID := r.Method() + " " + r.URL.Path()
+	actionID := actionID(r.Method(), r.URL.Path())
 	needsValidation := !statePreservingMethods[r.Method()]
 	if needsValidation {
 		f, err := r.PostForm()
+		if errors.Is(err, safehttp.ErrBodyTooLarge) {
+			return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+		}
 		if err != nil {
 			// We fallback to checking whether the form is multipart. Both types
 			// are valid in an incoming request as long as the XSRF token is
 			// present.
-			mf, err := r.MultipartForm(32 << 20)
+			mf, err := r.MultipartForm(maxMemory)
+			if errors.Is(err, safehttp.ErrBodyTooLarge) {
+				return w.WriteError(safehttp.StatusRequestEntityTooLarge)
+			}
 			if err != nil {
 				return w.WriteError(safehttp.StatusBadRequest)
 			}
@@ -109,3 +127,56 @@ func (i *Interceptor) Before(w *safehttp.ResponseWriter, r *safehttp.IncomingReq
 	r.SetContext(context.WithValue(r.Context(), tokenCtxKey{}, tok))
 	return safehttp.NotWritten()
 }
+
+// TokenFor returns an XSRF token for the user making the request, valid for
+// requests with the given method and path. It can be used to provide clients
+// with tokens for endpoints other than the one being served, e.g. WebSocket
+// endpoints.
+func (i *Interceptor) TokenFor(r *safehttp.IncomingRequest, method, path string) (string, error) {
+	userID, err := i.Identifier.UserID(r)
+	if err != nil {
+		return "", err
+	}
+	return xsrftoken.Generate(i.SecretAppKey, userID, actionID(method, path)), nil
+}
+
+// VerifyToken returns nil if tok is a valid XSRF token for the user making the
+// request and for the method and path of the request, and a non-nil error
+// otherwise. It can be used to validate tokens sent outside of forms, e.g. in
+// the query of a WebSocket upgrade request.
+func (i *Interceptor) VerifyToken(r *safehttp.IncomingRequest, tok string) error {
+	userID, err := i.Identifier.UserID(r)
+	if err != nil {
+		return err
+	}
+	if !xsrftoken.Valid(tok, i.SecretAppKey, userID, actionID(r.Method(), r.URL.Path())) {
+		return errors.New("invalid xsrf token")
+	}
+	return nil
+}
+
+func actionID(method, path string) string {
+	return method + " " + path
+}
+
+// Commit is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (i *Interceptor) Commit(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// After is a no-op, required to satisfy the safehttp.Interceptor interface.
+func (i *Interceptor) After(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg interface{}) {
+}
+
+// Config can be passed to safehttp.ServeMux.Handle in order to change the
+// behavior of the Interceptor on a specific route.
+type Config struct {
+	// Exempt disables XSRF protection on the route, e.g. for webhooks
+	// authenticated through other means. Token can't be used on exempt routes.
+	Exempt bool
+}
+
+// Match returns true if the interceptor is an XSRF Interceptor.
+func (Config) Match(i safehttp.Interceptor) bool {
+	_, ok := i.(*Interceptor)
+	return ok
+}
@@ -244,3 +244,111 @@ func TestMissingTokenInRequestContext(t *testing.T) {
 		t.Error("Token(req): got nil, want error")
 	}
 }
+
+func TestExemptConfig(t *testing.T) {
+	rec := safehttptest.NewResponseRecorder()
+	req := safehttptest.NewRequest(safehttp.MethodPost, "https://foo.com/pizza", nil)
+
+	i := Interceptor{SecretAppKey: "testSecretAppKey", Identifier: userIdentifier{}}
+	i.Before(rec.ResponseWriter, req, Config{Exempt: true})
+
+	if want, got := safehttp.StatusOK, rec.Status(); got != want {
+		t.Errorf("rec.Status() got: %v want: %v", got, want)
+	}
+	if diff := cmp.Diff(map[string][]string{}, map[string][]string(rec.Header())); diff != "" {
+		t.Errorf("rec.Header() mismatch (-want +got):\n%s", diff)
+	}
+	if _, err := Token(req); err == nil {
+		t.Error("Token(req) got: nil want: error")
+	}
+}
+
+type tooLargeReader struct{}
+
+func (tooLargeReader) Read([]byte) (int, error) {
+	return 0, safehttp.ErrBodyTooLarge
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	for _, ct := range []string{"application/x-www-form-urlencoded", "multipart/form-data; boundary=123"} {
+		t.Run(ct, func(t *testing.T) {
+			rec := safehttptest.NewResponseRecorder()
+			req := safehttptest.NewRequest(safehttp.MethodPost, "https://foo.com/pizza", tooLargeReader{})
+			req.Header.Set("Content-Type", ct)
+
+			i := Interceptor{SecretAppKey: "testSecretAppKey", Identifier: userIdentifier{}}
+			i.Before(rec.ResponseWriter, req, nil)
+
+			if want, got := safehttp.StatusRequestEntityTooLarge, rec.Status(); got != want {
+				t.Errorf("rec.Status() got: %v want: %v", got, want)
+			}
+		})
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	i := Interceptor{SecretAppKey: "testSecretAppKey", Identifier: userIdentifier{}}
+	pageReq := safehttptest.NewRequest(safehttp.MethodGet, "https://foo.com/chat", nil)
+	tok, err := i.TokenFor(pageReq, safehttp.MethodGet, "/chat/ws")
+	if err != nil {
+		t.Fatalf("i.TokenFor(pageReq, MethodGet, \"/chat/ws\") got err: %v want: nil", err)
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		tok     string
+		wantErr bool
+	}{
+		{
+			name:   "Valid token",
+			method: safehttp.MethodGet,
+			target: "https://foo.com/chat/ws",
+			tok:    tok,
+		},
+		{
+			name:    "Different path",
+			method:  safehttp.MethodGet,
+			target:  "https://foo.com/chat",
+			tok:     tok,
+			wantErr: true,
+		},
+		{
+			name:    "Different method",
+			method:  safehttp.MethodPost,
+			target:  "https://foo.com/chat/ws",
+			tok:     tok,
+			wantErr: true,
+		},
+		{
+			name:    "Different user",
+			method:  safehttp.MethodGet,
+			target:  "https://foo.com/chat/ws",
+			tok:     xsrftoken.Generate("testSecretAppKey", "5678", "GET /chat/ws"),
+			wantErr: true,
+		},
+		{
+			name:    "Empty token",
+			method:  safehttp.MethodGet,
+			target:  "https://foo.com/chat/ws",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := safehttptest.NewRequest(tt.method, tt.target, nil)
+			err := i.VerifyToken(req, tt.tok)
+			if tt.wantErr != (err != nil) {
+				t.Errorf("i.VerifyToken(req, tok) got err: %v want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigMatch(t *testing.T) {
+	if !(Config{}).Match(&Interceptor{}) {
+		t.Error("Config{}.Match(&Interceptor{}) got: false want: true")
+	}
+}
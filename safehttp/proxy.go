@@ -0,0 +1,215 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// trustedProxies are the networks of the proxies whose forwarding headers are
+// trusted.
+type trustedProxies []*net.IPNet
+
+// SetTrustedProxies sets the proxies, e.g. load balancers, whose forwarding
+// headers are trusted. Each proxy is given as an IP address or as a network
+// in CIDR notation, e.g. "10.0.0.0/8". It panics if one of them is invalid. It
+// must be called before the ServeMux starts serving requests.
+//
+// When a request is received from a trusted proxy, the client IP, the scheme
+// and the host returned by IncomingRequest.ClientIP, IncomingRequest.Scheme
+// and IncomingRequest.Host are the ones reported by the Forwarded header or,
+// in its absence, by the X-Forwarded-For, X-Forwarded-Proto and
+// X-Forwarded-Host headers. Forwarding headers of requests received from
+// other addresses are ignored, since they can be spoofed.
+func (m *ServeMux) SetTrustedProxies(proxies ...string) {
+	var tp trustedProxies
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				panic(fmt.Sprintf("invalid trusted proxy %q", p))
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			tp = append(tp, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy %q: %v", p, err))
+		}
+		tp = append(tp, n)
+	}
+	m.proxies = tp
+}
+
+func (tp trustedProxies) trusted(ip net.IP) bool {
+	for _, n := range tp {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedHop is a hop of the chain of proxies reported by the forwarding
+// headers. ip is nil if the hop isn't a valid IP address, e.g. if it's
+// obfuscated.
+type forwardedHop struct {
+	ip    net.IP
+	proto string
+	host  string
+}
+
+// resolve sets the client IP, the scheme and the host of ir according to the
+// forwarding headers of the request, if it has been received from a trusted
+// proxy.
+//
+// The hops are walked from the closest to the furthest one, as long as they
+// are trusted proxies. The values reported for the first untrusted hop, i.e.
+// the client, are used. For the X-Forwarded-Proto and X-Forwarded-Host
+// headers, which don't report per-hop values reliably, the values set by the
+// closest proxy are used.
+func (tp trustedProxies) resolve(ir *IncomingRequest, r *http.Request) {
+	if len(tp) == 0 || ir.clientIP == nil || !tp.trusted(ir.clientIP) {
+		return
+	}
+
+	var (
+		hops        []forwardedHop
+		proto, host string
+	)
+	if fwd := r.Header.Values("Forwarded"); len(fwd) > 0 {
+		hops = parseForwarded(fwd)
+	} else {
+		for _, ip := range headerList(r.Header.Values("X-Forwarded-For")) {
+			hops = append(hops, forwardedHop{ip: parseNodeIP(ip)})
+		}
+		if protos := headerList(r.Header.Values("X-Forwarded-Proto")); len(protos) > 0 {
+			proto = protos[len(protos)-1]
+		}
+		if hosts := headerList(r.Header.Values("X-Forwarded-Host")); len(hosts) > 0 {
+			host = hosts[len(hosts)-1]
+		}
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		h := hops[i]
+		if h.proto != "" {
+			proto = h.proto
+		}
+		if h.host != "" {
+			host = h.host
+		}
+		if h.ip == nil {
+			// The hop can't be identified, the closest proxy is the
+			// furthest known one.
+			break
+		}
+		ir.clientIP = h.ip
+		if !tp.trusted(h.ip) {
+			break
+		}
+	}
+
+	switch p := strings.ToLower(proto); p {
+	case "http", "https":
+		ir.scheme = p
+	}
+	if validHost(host) {
+		ir.host = host
+	}
+}
+
+// parseForwarded parses the values of Forwarded headers, as defined in
+// RFC 7239.
+func parseForwarded(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, elem := range headerList(values) {
+		var h forwardedHop
+		for _, pair := range strings.Split(elem, ";") {
+			i := strings.Index(pair, "=")
+			if i < 0 {
+				continue
+			}
+			key := strings.ToLower(strings.TrimSpace(pair[:i]))
+			val := strings.Trim(strings.TrimSpace(pair[i+1:]), `"`)
+			switch key {
+			case "for":
+				h.ip = parseNodeIP(val)
+			case "proto":
+				h.proto = val
+			case "host":
+				h.host = val
+			}
+		}
+		hops = append(hops, h)
+	}
+	return hops
+}
+
+// headerList returns the trimmed, non-empty elements of the comma-separated
+// lists of the given header values.
+func headerList(values []string) []string {
+	var l []string
+	for _, v := range values {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				l = append(l, e)
+			}
+		}
+	}
+	return l
+}
+
+// parseNodeIP parses the IP address of a node, optionally followed by a port,
+// e.g. "192.0.2.43", "192.0.2.43:47011" or "[2001:db8:cafe::17]:4711". It
+// returns nil if the node isn't a valid IP address.
+func parseNodeIP(node string) net.IP {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	return net.ParseIP(node)
+}
+
+// validHost reports whether host is a syntactically valid host, optionally
+// followed by a port.
+func validHost(host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, c := range host {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-.:[]", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// remoteIP returns the IP address of the peer that sent the request, or nil
+// if the remote address of the request is unknown.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
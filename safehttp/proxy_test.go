@@ -0,0 +1,169 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+)
+
+func TestMuxTrustedProxies(t *testing.T) {
+	type origin struct {
+		ClientIP, Scheme, Host string
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		tls        bool
+		headers    map[string]string
+		want       origin
+	}{
+		{
+			name:       "Direct request",
+			remoteAddr: "192.0.2.1:1234",
+			want:       origin{ClientIP: "192.0.2.1", Scheme: "http", Host: "foo.com"},
+		},
+		{
+			name:       "Direct TLS request",
+			remoteAddr: "192.0.2.1:1234",
+			tls:        true,
+			want:       origin{ClientIP: "192.0.2.1", Scheme: "https", Host: "foo.com"},
+		},
+		{
+			name:       "Spoofed headers from untrusted peer",
+			remoteAddr: "192.0.2.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "198.51.100.1",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "bar.com",
+				"Forwarded":         "for=198.51.100.1;proto=https",
+			},
+			want: origin{ClientIP: "192.0.2.1", Scheme: "http", Host: "foo.com"},
+		},
+		{
+			name:       "X-Forwarded headers",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "198.51.100.1",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "bar.com",
+			},
+			want: origin{ClientIP: "198.51.100.1", Scheme: "https", Host: "bar.com"},
+		},
+		{
+			name:       "X-Forwarded-For chain",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "203.0.113.7, 198.51.100.1, 10.0.0.2",
+			},
+			want: origin{ClientIP: "198.51.100.1", Scheme: "http", Host: "foo.com"},
+		},
+		{
+			name:       "X-Forwarded-For only trusted proxies",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "10.0.0.3, 10.0.0.2",
+			},
+			want: origin{ClientIP: "10.0.0.3", Scheme: "http", Host: "foo.com"},
+		},
+		{
+			name:       "Trusted single IP",
+			remoteAddr: "[2001:db8::1]:1234",
+			headers: map[string]string{
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: origin{ClientIP: "198.51.100.1", Scheme: "http", Host: "foo.com"},
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded": `for="[2001:db8:cafe::17]:4711";proto=https;host=bar.com, for=10.0.0.2;proto=http`,
+			},
+			want: origin{ClientIP: "2001:db8:cafe::17", Scheme: "https", Host: "bar.com"},
+		},
+		{
+			name:       "Forwarded takes precedence",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       "for=198.51.100.1",
+				"X-Forwarded-For": "203.0.113.7",
+			},
+			want: origin{ClientIP: "198.51.100.1", Scheme: "http", Host: "foo.com"},
+		},
+		{
+			name:       "Forwarded obfuscated client",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded": "for=_hidden;proto=https, for=10.0.0.2",
+			},
+			want: origin{ClientIP: "10.0.0.2", Scheme: "https", Host: "foo.com"},
+		},
+		{
+			name:       "Invalid scheme and host",
+			remoteAddr: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-Proto": "javascript",
+				"X-Forwarded-Host":  "bar.com/evil",
+			},
+			want: origin{ClientIP: "10.0.0.1", Scheme: "http", Host: "foo.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := safehttp.NewServeMux(testDispatcher{}, "foo.com")
+			mux.SetTrustedProxies("10.0.0.0/8", "2001:db8::1")
+			var got origin
+			mux.Handle("/", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+				got = origin{ClientIP: r.ClientIP().String(), Scheme: r.Scheme(), Host: r.Host()}
+				return w.NoContent()
+			}))
+
+			req := httptest.NewRequest(safehttp.MethodGet, "http://foo.com/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			mux.ServeHTTP(newResponseRecorder(&strings.Builder{}), req)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("origin mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestMuxSetTrustedProxiesInvalid(t *testing.T) {
+	for _, p := range []string{"10.0.0.0/33", "not an ip", ""} {
+		t.Run(p, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("mux.SetTrustedProxies(%q) expected panic", p)
+				}
+			}()
+			safehttp.NewServeMux(testDispatcher{}, "foo.com").SetTrustedProxies(p)
+		})
+	}
+}
@@ -19,6 +19,14 @@ import "io"
 // Response TODO
 type Response interface{}
 
+// JSONResponse is a Response that is serialised as JSON by the
+// DefaultDispatcher. Data is encoded with encoding/json and the result is
+// prefixed with ")]}'\n" to protect it from cross-site script inclusion
+// (XSSI). Clients have to strip the prefix before parsing the response.
+type JSONResponse struct {
+	Data interface{}
+}
+
 // Template TODO
 type Template interface {
 	Execute(wr io.Writer, data interface{}) error
@@ -15,6 +15,10 @@
 package safehttp
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 )
 
@@ -27,6 +31,20 @@ type ResponseWriter struct {
 	// easily overwrite the struct bypassing all our safety guarantees.
 	header  Header
 	written bool
+
+	// The request being responded to and the interceptors whose Commit stage
+	// needs to run before the response is committed.
+	req       *IncomingRequest
+	interceps []appliedInterceptor
+	status    StatusCode
+	committed bool
+	// sent is set once the status code and the headers have been sent.
+	sent bool
+
+	// errHook is called with the errors that occur while writing the response.
+	// err is the first of them.
+	errHook ErrorHook
+	err     error
 }
 
 // NewResponseWriter creates a ResponseWriter from a safehttp.Dispatcher, an
@@ -53,49 +71,183 @@ func NotWritten() Result {
 	return Result{}
 }
 
-// Write TODO
+// Write dispatches the response to the Dispatcher with a 200 OK status code.
 func (w *ResponseWriter) Write(resp Response) Result {
+	return w.WriteWithStatus(StatusOK, resp)
+}
+
+// WriteWithStatus dispatches the response to the Dispatcher with the provided
+// status code. The status code must be a 2xx, 4xx or 5xx status code that
+// allows a response body, i.e. not 204 No Content or 205 Reset Content.
+// Otherwise, WriteWithStatus panics. Use NoContent and Redirect to respond with
+// these status codes instead.
+//
+// If the Dispatcher fails, the error is recorded (retrievable by Err()) and
+// reported to the ErrorHook of the ServeMux. If nothing had been written by the
+// Dispatcher yet, a 500 Internal Server Error response is written instead.
+func (w *ResponseWriter) WriteWithStatus(code StatusCode, resp Response) Result {
+	checkBodyStatus(code)
 	w.markWritten()
-	if err := w.d.Write(w.rw, resp); err != nil {
-		panic("error")
+	w.status = code
+	if err := w.d.Write(responseCommitter{w}, resp); err != nil {
+		w.fail(err)
+		return Result{}
 	}
+	w.commit()
 	return Result{}
 }
 
-// WriteTemplate TODO
+// WriteTemplate executes the template through the Dispatcher with a 200 OK
+// status code.
 func (w *ResponseWriter) WriteTemplate(t Template, data interface{}) Result {
+	return w.WriteTemplateWithStatus(StatusOK, t, data)
+}
+
+// WriteTemplateWithStatus executes the template through the Dispatcher with
+// the provided status code. The same restrictions as for WriteWithStatus apply
+// to the status code.
+func (w *ResponseWriter) WriteTemplateWithStatus(code StatusCode, t Template, data interface{}) Result {
+	checkBodyStatus(code)
 	w.markWritten()
-	if err := w.d.ExecuteTemplate(w.rw, t, data); err != nil {
-		panic("error")
+	w.status = code
+	if err := w.d.ExecuteTemplate(responseCommitter{w}, t, data); err != nil {
+		w.fail(err)
+		return Result{}
 	}
+	w.commit()
 	return Result{}
 }
 
+// checkBodyStatus panics if a response with the provided status code can't have
+// a body written by the Dispatcher.
+func checkBodyStatus(code StatusCode) {
+	switch {
+	case code == StatusNoContent || code == StatusResetContent:
+	case code >= 200 && code < 300, code >= 400 && code < 600:
+		return
+	}
+	panic(fmt.Sprintf("status code %d can't be used with a response body", code))
+}
+
 // NoContent responds with a 204 No Content response.
 func (w *ResponseWriter) NoContent() Result {
 	w.markWritten()
-	w.rw.WriteHeader(int(StatusNoContent))
+	w.status = StatusNoContent
+	w.commit()
 	return Result{}
 }
 
 // WriteError writes an error response (400-599) according to the provided status
-// code.
+// code. If the Dispatcher implements ErrorRenderer, the body of the response is
+// the one it renders. Otherwise, or if rendering the error fails before
+// anything has been written, a plain text body containing the status text is
+// written.
 func (w *ResponseWriter) WriteError(code StatusCode) Result {
 	w.markWritten()
-	http.Error(w.rw, http.StatusText(int(code)), int(code))
+	w.status = code
+	w.writeError()
 	return Result{}
 }
 
+// writeError writes the error response corresponding to the status code of the
+// ResponseWriter.
+func (w *ResponseWriter) writeError() {
+	code := w.status
+	if er, ok := w.d.(ErrorRenderer); ok {
+		if resp := er.RenderError(w.req, code); resp != nil {
+			err := w.d.Write(responseCommitter{w}, resp)
+			if err != nil {
+				w.report(err)
+			}
+			if err == nil || w.committed {
+				w.commit()
+				return
+			}
+		}
+	}
+	http.Error(responseCommitter{w}, http.StatusText(int(code)), int(code))
+}
+
+// fail reports the error and, unless the response has already been committed,
+// responds with a 500 Internal Server Error instead.
+func (w *ResponseWriter) fail(err error) {
+	w.report(err)
+	if w.committed {
+		return
+	}
+	w.status = StatusInternalServerError
+	w.writeError()
+}
+
+// report records the error and passes it to the error hook, if any.
+func (w *ResponseWriter) report(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+	if w.errHook != nil {
+		w.errHook(w.req, err)
+	}
+}
+
+// Err returns nil unless an error occurred while writing the response, e.g.
+// because the Dispatcher failed. Calling this method will return the first
+// error that occurred.
+func (w *ResponseWriter) Err() error {
+	return w.err
+}
+
 // Redirect responds with a redirect to a given url, using code as the status code.
 func (w *ResponseWriter) Redirect(r *IncomingRequest, url string, code StatusCode) Result {
 	w.markWritten()
 	if code < 300 || code >= 400 {
 		panic("wrong method called")
 	}
-	http.Redirect(w.rw, r.req, url, int(code))
+	w.status = code
+	http.Redirect(responseCommitter{w}, r.req, url, int(code))
 	return Result{}
 }
 
+// SwitchProtocols responds with a 101 Switching Protocols status code and the
+// headers set on the ResponseWriter, and then takes over the underlying
+// connection, e.g. in order to upgrade it to the WebSocket protocol. The
+// response is committed before being sent, as for any other response.
+//
+// Once SwitchProtocols returns, the caller is responsible for the connection
+// and must close it. If the connection can't be taken over, a 500 Internal
+// Server Error response is written instead and an error is returned.
+func (w *ResponseWriter) SwitchProtocols() (net.Conn, *bufio.ReadWriter, error) {
+	w.markWritten()
+	hj, ok := w.rw.(http.Hijacker)
+	if !ok {
+		err := errors.New("the connection doesn't support switching protocols")
+		w.fail(err)
+		return nil, nil, err
+	}
+
+	w.status = StatusSwitchingProtocols
+	w.committed = true
+	w.runCommit()
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		// The Commit stage already ran, the error response is sent as is.
+		w.report(err)
+		w.status = StatusInternalServerError
+		http.Error(w.rw, http.StatusText(int(w.status)), int(w.status))
+		w.sent = true
+		return nil, nil, err
+	}
+	w.sent = true
+
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	w.rw.Header().Write(brw)
+	brw.WriteString("\r\n")
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, brw, nil
+}
+
 // markWritten ensures that the ResponseWriter is only written to once by panicking
 // if it is written more than once.
 func (w *ResponseWriter) markWritten() {
@@ -105,6 +257,34 @@ func (w *ResponseWriter) markWritten() {
 	w.written = true
 }
 
+// commit runs the Commit stage of the interceptors and then writes the status
+// code and the headers of the response. It only has an effect the first time it
+// is called.
+func (w *ResponseWriter) commit() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.runCommit()
+	w.rw.WriteHeader(int(w.status))
+	w.sent = true
+}
+
+// runCommit runs the Commit stage of the interceptors, in reverse order.
+func (w *ResponseWriter) runCommit() {
+	for i := len(w.interceps) - 1; i >= 0; i-- {
+		it := w.interceps[i]
+		it.it.Commit(w, w.req, it.cfg)
+	}
+}
+
+// Status returns the status code of the response. It is only meaningful once a
+// response has been written, e.g. during the Commit and After stages of
+// interceptors, and returns 0 otherwise.
+func (w *ResponseWriter) Status() StatusCode {
+	return w.status
+}
+
 // Header returns the collection of headers that will be set
 // on the response. Headers must be set before writing a
 // response (e.g. Write, WriteTemplate).
@@ -119,8 +299,39 @@ func (w *ResponseWriter) SetCookie(c *Cookie) error {
 	return w.header.addCookie(c)
 }
 
+// responseCommitter is the http.ResponseWriter passed to the Dispatcher. It
+// commits the response right before its status code or its body are written.
+// The status code is always the one chosen by the ResponseWriter.
+type responseCommitter struct {
+	w *ResponseWriter
+}
+
+func (c responseCommitter) Header() http.Header {
+	return c.w.rw.Header()
+}
+
+func (c responseCommitter) WriteHeader(int) {
+	c.w.commit()
+}
+
+func (c responseCommitter) Write(b []byte) (int, error) {
+	c.w.commit()
+	return c.w.rw.Write(b)
+}
+
 // Dispatcher TODO
 type Dispatcher interface {
 	Write(rw http.ResponseWriter, resp Response) error
 	ExecuteTemplate(rw http.ResponseWriter, t Template, data interface{}) error
 }
+
+// ErrorRenderer can be optionally implemented by a Dispatcher in order to
+// customise the body of error responses, e.g. to serve branded error pages or
+// machine-readable errors to API clients.
+type ErrorRenderer interface {
+	// RenderError returns the Response to be written through the Dispatcher
+	// for an error with the given status code. The request is nil if the
+	// ResponseWriter wasn't created by a ServeMux. If RenderError returns nil,
+	// the default plain text error response is written instead.
+	RenderError(r *IncomingRequest, code StatusCode) Response
+}
@@ -73,6 +73,20 @@ func TestResponseWriterWriteTwicePanic(t *testing.T) {
 				w.WriteTemplate(template.Must(template.New("name").Parse("<h1>{{ . }}</h1>")), "This is an actual heading, though.")
 			},
 		},
+		{
+			name: "Call WriteWithStatus twice",
+			write: func(w *safehttp.ResponseWriter) {
+				w.WriteWithStatus(safehttp.StatusNotFound, safehtml.HTMLEscaped("<h1>Escaped, so not really a heading</h1>"))
+				w.WriteWithStatus(safehttp.StatusNotFound, safehtml.HTMLEscaped("<h1>Escaped, so not really a heading</h1>"))
+			},
+		},
+		{
+			name: "Call Write then WriteTemplateWithStatus",
+			write: func(w *safehttp.ResponseWriter) {
+				w.Write(safehtml.HTMLEscaped("<h1>Escaped, so not really a heading</h1>"))
+				w.WriteTemplateWithStatus(safehttp.StatusCreated, template.Must(template.New("name").Parse("<h1>{{ . }}</h1>")), "This is an actual heading, though.")
+			},
+		},
 		{
 			name: "Call NoContent twice",
 			write: func(w *safehttp.ResponseWriter) {
@@ -109,3 +123,130 @@ func TestResponseWriterWriteTwicePanic(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseWriterWriteWithStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(w *safehttp.ResponseWriter)
+		wantCode safehttp.StatusCode
+		wantBody string
+	}{
+		{
+			name: "WriteWithStatus Created",
+			write: func(w *safehttp.ResponseWriter) {
+				w.WriteWithStatus(safehttp.StatusCreated, safehtml.HTMLEscaped("<h1>Created</h1>"))
+			},
+			wantCode: safehttp.StatusCreated,
+			wantBody: "&lt;h1&gt;Created&lt;/h1&gt;",
+		},
+		{
+			name: "WriteWithStatus Not Found",
+			write: func(w *safehttp.ResponseWriter) {
+				w.WriteWithStatus(safehttp.StatusNotFound, safehtml.HTMLEscaped("<h1>Not Found</h1>"))
+			},
+			wantCode: safehttp.StatusNotFound,
+			wantBody: "&lt;h1&gt;Not Found&lt;/h1&gt;",
+		},
+		{
+			name: "WriteTemplateWithStatus Unprocessable Entity",
+			write: func(w *safehttp.ResponseWriter) {
+				w.WriteTemplateWithStatus(safehttp.StatusUnprocessableEntity, template.Must(template.New("name").Parse("<h1>{{ . }}</h1>")), "Invalid form")
+			},
+			wantCode: safehttp.StatusUnprocessableEntity,
+			wantBody: "<h1>Invalid form</h1>",
+		},
+		{
+			name: "WriteTemplateWithStatus Service Unavailable",
+			write: func(w *safehttp.ResponseWriter) {
+				w.WriteTemplateWithStatus(safehttp.StatusServiceUnavailable, template.Must(template.New("name").Parse("<h1>{{ . }}</h1>")), "Try again later")
+			},
+			wantCode: safehttp.StatusServiceUnavailable,
+			wantBody: "<h1>Try again later</h1>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rr := newResponseRecorder(b)
+			w := safehttp.NewResponseWriter(testDispatcher{}, rr)
+
+			tt.write(w)
+
+			if rr.status != tt.wantCode {
+				t.Errorf("rr.status got: %v want: %v", rr.status, tt.wantCode)
+			}
+			if got := w.Status(); got != tt.wantCode {
+				t.Errorf("w.Status() got: %v want: %v", got, tt.wantCode)
+			}
+			if got := b.String(); got != tt.wantBody {
+				t.Errorf("response body got: %q want: %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestResponseWriterWriteWithInvalidStatusPanic(t *testing.T) {
+	tests := []struct {
+		name string
+		code safehttp.StatusCode
+	}{
+		{name: "Continue", code: safehttp.StatusContinue},
+		{name: "No Content", code: safehttp.StatusNoContent},
+		{name: "Reset Content", code: safehttp.StatusResetContent},
+		{name: "Moved Permanently", code: safehttp.StatusMovedPermanently},
+		{name: "Not Modified", code: safehttp.StatusNotModified},
+		{name: "Out of range", code: safehttp.StatusCode(600)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			rr := newResponseRecorder(b)
+			w := safehttp.NewResponseWriter(testDispatcher{}, rr)
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("w.WriteWithStatus(%v, resp) expected panic", tt.code)
+				}
+				if got := b.String(); got != "" {
+					t.Errorf("response body got: %q want: empty", got)
+				}
+			}()
+			w.WriteWithStatus(tt.code, safehtml.HTMLEscaped("<h1>Escaped, so not really a heading</h1>"))
+		})
+	}
+}
+
+func TestResponseWriterDispatcherFailure(t *testing.T) {
+	b := &strings.Builder{}
+	rr := newResponseRecorder(b)
+	w := safehttp.NewResponseWriter(failingDispatcher{}, rr)
+
+	w.Write(safehtml.HTMLEscaped("<h1>Escaped, so not really a heading</h1>"))
+
+	if w.Err() == nil {
+		t.Error("w.Err() got: nil want: error")
+	}
+	if want := safehttp.StatusInternalServerError; rr.status != want {
+		t.Errorf("rr.status got: %v want: %v", rr.status, want)
+	}
+	if got, want := b.String(), "Internal Server Error\n"; got != want {
+		t.Errorf("response body got: %q want: %q", got, want)
+	}
+}
+
+func TestResponseWriterSwitchProtocolsNotSupported(t *testing.T) {
+	b := &strings.Builder{}
+	rr := newResponseRecorder(b)
+	w := safehttp.NewResponseWriter(testDispatcher{}, rr)
+
+	if _, _, err := w.SwitchProtocols(); err == nil {
+		t.Error("w.SwitchProtocols() got: nil want: error")
+	}
+	if want := safehttp.StatusInternalServerError; rr.status != want {
+		t.Errorf("rr.status got: %v want: %v", rr.status, want)
+	}
+	if got, want := b.String(), "Internal Server Error\n"; got != want {
+		t.Errorf("response body got: %q want: %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// StreamDispatcher can be optionally implemented by a Dispatcher in order to
+// support streamed responses, written through ResponseWriter.Stream.
+type StreamDispatcher interface {
+	// ContentType returns the Content-Type of a stream made of fragments like
+	// resp. It returns an error if resp can't be streamed.
+	ContentType(resp Response) (string, error)
+
+	// WriteFragment writes resp as a fragment of the stream. first is true if
+	// resp is the first fragment of the stream.
+	WriteFragment(w io.Writer, resp Response, first bool) error
+}
+
+// Stream is a streamed response, made of a sequence of fragments that are
+// sent to the client as soon as they are written. It is created by
+// ResponseWriter.Stream.
+type Stream struct {
+	w           *ResponseWriter
+	sd          StreamDispatcher
+	contentType string
+	err         error
+}
+
+// errStreamClosed is returned when writing to a closed Stream.
+var errStreamClosed = errors.New("write on closed stream")
+
+// Stream starts a streamed response with a 200 OK status code. The Dispatcher
+// must implement StreamDispatcher, otherwise Stream panics.
+//
+// The response is committed, i.e. the Commit stage of the interceptors is run
+// and its status code and headers are sent, right before the first fragment is
+// sent. Headers can't be modified after that. The Stream must be closed once
+// all the fragments have been written.
+func (w *ResponseWriter) Stream() *Stream {
+	sd, ok := w.d.(StreamDispatcher)
+	if !ok {
+		panic(fmt.Sprintf("%T doesn't support streamed responses", w.d))
+	}
+	w.markWritten()
+	w.status = StatusOK
+	return &Stream{w: w, sd: sd}
+}
+
+// Write writes a fragment to the Stream and flushes it to the client. All the
+// fragments of a Stream must have the same Content-Type, as reported by the
+// StreamDispatcher.
+//
+// If the Dispatcher fails, the error is reported like for
+// ResponseWriter.Write and the Stream is closed. If no fragment had been sent
+// yet, a 500 Internal Server Error response is written instead. Once Write has
+// returned an error, all subsequent calls return an error as well.
+func (s *Stream) Write(resp Response) error {
+	if s.err != nil {
+		return s.err
+	}
+
+	first := s.contentType == ""
+	ct, err := s.sd.ContentType(resp)
+	if err == nil && !first && ct != s.contentType {
+		err = fmt.Errorf("fragment with Content-Type %q in a stream with Content-Type %q", ct, s.contentType)
+	}
+	var b bytes.Buffer
+	if err == nil {
+		err = s.sd.WriteFragment(&b, resp, first)
+	}
+	if err != nil {
+		s.err = err
+		s.w.fail(err)
+		return err
+	}
+
+	if first {
+		s.contentType = ct
+		s.w.rw.Header().Set("Content-Type", ct)
+		s.w.commit()
+	}
+	if _, err := s.w.rw.Write(b.Bytes()); err != nil {
+		s.err = err
+		return err
+	}
+	if f, ok := s.w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Close closes the Stream. If no fragment has been written, the response is
+// committed with an empty body.
+func (s *Stream) Close() Result {
+	if s.err == nil {
+		s.err = errStreamClosed
+	}
+	s.w.commit()
+	return Result{}
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/safehtml"
+)
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name            string
+		fragments       []safehttp.Response
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name: "HTML",
+			fragments: []safehttp.Response{
+				safehtml.HTMLEscaped("<h1>Report</h1>"),
+				safehtml.HTMLEscaped("<p>First</p>"),
+				safehtml.HTMLEscaped("<p>Second</p>"),
+			},
+			wantContentType: "text/html; charset=utf-8",
+			wantBody:        "&lt;h1&gt;Report&lt;/h1&gt;&lt;p&gt;First&lt;/p&gt;&lt;p&gt;Second&lt;/p&gt;",
+		},
+		{
+			name: "JSON lines",
+			fragments: []safehttp.Response{
+				safehttp.JSONResponse{Data: map[string]int{"line": 1}},
+				safehttp.JSONResponse{Data: "multi\nline"},
+			},
+			wantContentType: "application/x-ndjson; charset=utf-8",
+			wantBody:        ")]}'\n{\"line\":1}\n\"multi\\nline\"\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+
+			s := w.Stream()
+			for _, f := range tt.fragments {
+				if err := s.Write(f); err != nil {
+					t.Fatalf("s.Write(%v) got err: %v want: nil", f, err)
+				}
+				if !rec.Flushed {
+					t.Errorf("rec.Flushed got: false want: true")
+				}
+			}
+			s.Close()
+
+			if got, want := rec.Code, http.StatusOK; got != want {
+				t.Errorf("rec.Code got: %v want: %v", got, want)
+			}
+			if got := rec.Header().Get("Content-Type"); got != tt.wantContentType {
+				t.Errorf(`rec.Header().Get("Content-Type") got: %q want: %q`, got, tt.wantContentType)
+			}
+			if got := rec.Body.String(); got != tt.wantBody {
+				t.Errorf("rec.Body.String() got: %q want: %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestStreamInvalidFirstFragment(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+
+	s := w.Stream()
+	if err := s.Write("<h1>Not safe</h1>"); err == nil {
+		t.Error(`s.Write("<h1>Not safe</h1>") got: nil want: error`)
+	}
+	if err := s.Write(safehtml.HTMLEscaped("<h1>Safe</h1>")); err == nil {
+		t.Error("s.Write() after a failure got: nil want: error")
+	}
+	s.Close()
+
+	if got, want := rec.Code, http.StatusInternalServerError; got != want {
+		t.Errorf("rec.Code got: %v want: %v", got, want)
+	}
+	if got, want := rec.Body.String(), "Internal Server Error\n"; got != want {
+		t.Errorf("rec.Body.String() got: %q want: %q", got, want)
+	}
+}
+
+func TestStreamMixedFragments(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+
+	s := w.Stream()
+	if err := s.Write(safehtml.HTMLEscaped("<h1>Report</h1>")); err != nil {
+		t.Fatalf("s.Write() got err: %v want: nil", err)
+	}
+	if err := s.Write(safehttp.JSONResponse{Data: "data"}); err == nil {
+		t.Error("s.Write(safehttp.JSONResponse{}) got: nil want: error")
+	}
+	s.Close()
+
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Errorf("rec.Code got: %v want: %v", got, want)
+	}
+	if got, want := rec.Body.String(), "&lt;h1&gt;Report&lt;/h1&gt;"; got != want {
+		t.Errorf("rec.Body.String() got: %q want: %q", got, want)
+	}
+}
+
+func TestStreamCloseWithoutFragments(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := safehttp.NewResponseWriter(safehttp.DefaultDispatcher{}, rec)
+
+	s := w.Stream()
+	s.Close()
+	if err := s.Write(safehtml.HTMLEscaped("<h1>Report</h1>")); err == nil {
+		t.Error("s.Write() after s.Close() got: nil want: error")
+	}
+
+	if got, want := rec.Code, http.StatusOK; got != want {
+		t.Errorf("rec.Code got: %v want: %v", got, want)
+	}
+	if got := rec.Body.String(); got != "" {
+		t.Errorf("rec.Body.String() got: %q want: empty", got)
+	}
+}
+
+func TestStreamUnsupportedDispatcherPanic(t *testing.T) {
+	w := safehttp.NewResponseWriter(testDispatcher{}, httptest.NewRecorder())
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("w.Stream() expected panic")
+		}
+	}()
+	w.Stream()
+}
+
+func TestMuxStreamInterceptorStages(t *testing.T) {
+	var stages []string
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(stagesInterceptor{name: "one", stages: &stages})
+	mux.Handle("/report", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		s := w.Stream()
+		stages = append(stages, "stream")
+		s.Write(safehtml.HTMLEscaped("first"))
+		stages = append(stages, "first fragment")
+		s.Write(safehtml.HTMLEscaped("second"))
+		return s.Close()
+	}))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/report", nil))
+
+	wantStages := []string{"one Before", "stream", "one Commit 200", "first fragment", "one After 200"}
+	if diff := cmp.Diff(wantStages, stages); diff != "" {
+		t.Errorf("stages mismatch (-want +got):\n%s", diff)
+	}
+	if got, want := rec.Header().Get("Committed-By"), "one"; got != want {
+		t.Errorf(`rec.Header().Get("Committed-By") got: %q want: %q`, got, want)
+	}
+	if got, want := rec.Body.String(), "firstsecond"; got != want {
+		t.Errorf("rec.Body.String() got: %q want: %q", got, want)
+	}
+}
+
+func TestMuxStreamNotClosed(t *testing.T) {
+	var stages []string
+	mux := safehttp.NewServeMux(nil, "foo.com")
+	mux.Install(stagesInterceptor{name: "one", stages: &stages})
+	mux.Handle("/report", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		w.Stream()
+		return safehttp.Result{}
+	}))
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(safehttp.MethodGet, "http://foo.com/report", nil))
+
+	wantStages := []string{"one Before", "one Commit 200", "one After 200"}
+	if diff := cmp.Diff(wantStages, stages); diff != "" {
+		t.Errorf("stages mismatch (-want +got):\n%s", diff)
+	}
+	if got := strings.Join(rec.Header()["Committed-By"], ","); got != "one" {
+		t.Errorf(`rec.Header()["Committed-By"] got: %q want: "one"`, got)
+	}
+}
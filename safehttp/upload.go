@@ -0,0 +1,246 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// sniffLen is the number of bytes used by http.DetectContentType.
+const sniffLen = 512
+
+// sniffedEquivalents maps the generic media types returned by
+// http.DetectContentType to the declared media types they are accepted for,
+// besides themselves.
+var sniffedEquivalents = map[string][]string{
+	"text/plain": {"text/csv", "text/markdown", "text/tab-separated-values", "application/json"},
+	"text/xml":   {"application/xml"},
+	"application/zip": {
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	},
+	"application/octet-stream": {"application/x-tar"},
+}
+
+// UploadSpec declares the files accepted by a MultipartReader.
+type UploadSpec struct {
+	// Types maps the media types of the files that can be uploaded, e.g.
+	// "image/png", to the extensions their file names can have, e.g. ".png".
+	// The media type declared in the Content-Type of a file part must be in
+	// Types and must match the media type sniffed from its content, and the
+	// extension of the file name must be one of those of the declared media
+	// type. Extensions are compared case-insensitively. If Types is empty,
+	// no files can be uploaded.
+	//
+	// The content of some formats can't be told apart by
+	// http.DetectContentType, e.g. CSV and JSON files are sniffed as
+	// text/plain. Such media types are accepted for files sniffed as one of
+	// the generic types they are listed under in sniffedEquivalents.
+	Types map[string][]string
+	// MaxFiles is the maximum number of files in the form. If zero, the
+	// number is unlimited.
+	MaxFiles int
+	// MaxFileSize is the maximum size in bytes of each file. If zero, the
+	// size is unlimited.
+	MaxFileSize int64
+}
+
+// MultipartReader iterates over the parts of a multipart form, part of the
+// body of a PATCH, POST or PUT request, without buffering them. Unlike
+// IncomingRequest.MultipartForm, the files uploaded in the form are checked
+// against an UploadSpec as they are read.
+type MultipartReader struct {
+	mr    *multipart.Reader
+	spec  UploadSpec
+	files int
+}
+
+// MultipartReader returns a MultipartReader streaming the multipart form
+// provided in the body of a POST, PATCH or PUT request that has Content-Type
+// set to multipart/form-data. It returns an error if the request isn't
+// such a request or if its form has already been parsed by
+// IncomingRequest.MultipartForm.
+func (r *IncomingRequest) MultipartReader(spec UploadSpec) (*MultipartReader, error) {
+	if m := r.req.Method; m != MethodPost && m != MethodPatch && m != MethodPut {
+		return nil, &RequestError{Code: StatusBadRequest, Err: fmt.Errorf("got request method %s, want POST/PATCH/PUT", m)}
+	}
+	if ct := r.req.Header.Get("Content-Type"); !strings.HasPrefix(ct, "multipart/form-data") {
+		return nil, &RequestError{Code: StatusUnsupportedMediaType, Err: fmt.Errorf("invalid method called for Content-Type: %s", ct)}
+	}
+	mr, err := r.req.MultipartReader()
+	if err != nil {
+		return nil, &RequestError{Code: StatusBadRequest, Err: err}
+	}
+	return &MultipartReader{mr: mr, spec: spec}, nil
+}
+
+// NextPart returns the next part of the form, or io.EOF if there are no more
+// parts. Parts must be read before calling NextPart again.
+//
+// If the part is a file that doesn't satisfy the UploadSpec, NextPart returns
+// a *RequestError with a 415 Unsupported Media Type status code if its type
+// or extension isn't allowed and 413 Request Entity Too Large if there are
+// too many files. Reading a file larger than allowed fails with a
+// *RequestError with a 413 Request Entity Too Large status code as well.
+// Other errors have a 400 Bad Request status code.
+func (r *MultipartReader) NextPart() (*Part, error) {
+	p, err := r.mr.NextPart()
+	if err == io.EOF {
+		return nil, err
+	}
+	if errors.Is(err, ErrBodyTooLarge) {
+		return nil, &RequestError{Code: StatusRequestEntityTooLarge, Err: err}
+	}
+	if err != nil {
+		return nil, &RequestError{Code: StatusBadRequest, Err: err}
+	}
+	if p.FormName() == "" {
+		return nil, &RequestError{Code: StatusBadRequest, Err: errors.New("multipart: missing form name")}
+	}
+	if p.FileName() == "" {
+		return &Part{p: p, r: p}, nil
+	}
+
+	r.files++
+	if r.spec.MaxFiles > 0 && r.files > r.spec.MaxFiles {
+		return nil, &RequestError{Code: StatusRequestEntityTooLarge, Err: fmt.Errorf("too many files: want at most %d", r.spec.MaxFiles)}
+	}
+
+	declared := "application/octet-stream"
+	if ct := p.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return nil, &RequestError{Code: StatusUnsupportedMediaType, Err: err}
+		}
+		declared = mt
+	}
+	exts, ok := r.spec.Types[declared]
+	if !ok {
+		return nil, &RequestError{Code: StatusUnsupportedMediaType, Err: fmt.Errorf("file %q: media type %q not allowed", p.FileName(), declared)}
+	}
+	if !allowedExt(path.Ext(p.FileName()), exts) {
+		return nil, &RequestError{Code: StatusUnsupportedMediaType, Err: fmt.Errorf("file %q: extension doesn't match media type %q", p.FileName(), declared)}
+	}
+
+	br := bufio.NewReaderSize(p, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return nil, &RequestError{Code: StatusRequestEntityTooLarge, Err: err}
+		}
+		return nil, &RequestError{Code: StatusBadRequest, Err: err}
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !sniffedMatches(sniffed, declared) {
+		return nil, &RequestError{Code: StatusUnsupportedMediaType, Err: fmt.Errorf("file %q: sniffed media type %q doesn't match declared media type %q", p.FileName(), sniffed, declared)}
+	}
+
+	return &Part{p: p, r: br, contentType: declared, remaining: r.spec.MaxFileSize, limited: r.spec.MaxFileSize > 0}, nil
+}
+
+// sniffedMatches reports whether a file sniffed as the sniffed media type can
+// have the declared media type.
+func sniffedMatches(sniffed, declared string) bool {
+	if sniffed == declared {
+		return true
+	}
+	for _, mt := range sniffedEquivalents[sniffed] {
+		if mt == declared {
+			return true
+		}
+	}
+	return false
+}
+
+func allowedExt(ext string, exts []string) bool {
+	for _, e := range exts {
+		if strings.EqualFold(ext, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// Part is a part of a multipart form, either a form value or a file.
+type Part struct {
+	p           *multipart.Part
+	r           io.Reader
+	contentType string
+	remaining   int64
+	limited     bool
+	err         error
+}
+
+// FormName returns the name of the form parameter of the part.
+func (p *Part) FormName() string {
+	return p.p.FormName()
+}
+
+// FileName returns the base name of the file, or the empty string if the part
+// is a form value.
+func (p *Part) FileName() string {
+	return p.p.FileName()
+}
+
+// ContentType returns the media type of the file, checked against the
+// UploadSpec, or the empty string if the part is a form value.
+func (p *Part) ContentType() string {
+	return p.contentType
+}
+
+// Read reads the content of the part. See MultipartReader.NextPart for the
+// errors returned when the part is a file larger than allowed.
+func (p *Part) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if !p.limited {
+		return p.read(b)
+	}
+	// Read one byte more than allowed in order to detect files that are
+	// exactly at the limit.
+	if int64(len(b)) > p.remaining+1 {
+		b = b[:p.remaining+1]
+	}
+	n, err := p.read(b)
+	if int64(n) <= p.remaining {
+		p.remaining -= int64(n)
+		return n, err
+	}
+	n = int(p.remaining)
+	p.remaining = 0
+	p.err = &RequestError{Code: StatusRequestEntityTooLarge, Err: fmt.Errorf("file %q too large", p.FileName())}
+	return n, p.err
+}
+
+func (p *Part) read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		if errors.Is(err, ErrBodyTooLarge) {
+			return n, &RequestError{Code: StatusRequestEntityTooLarge, Err: err}
+		}
+		return n, &RequestError{Code: StatusBadRequest, Err: err}
+	}
+	return n, err
+}
@@ -0,0 +1,277 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package safehttp_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+// pngHeader is enough for http.DetectContentType to sniff image/png.
+const pngHeader = "\x89PNG\x0D\x0A\x1A\x0A"
+
+type testPart struct {
+	name, fileName, contentType, content string
+}
+
+func newMultipartRequest(t *testing.T, parts ...testPart) *safehttp.IncomingRequest {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, p := range parts {
+		h := textproto.MIMEHeader{}
+		cd := fmt.Sprintf("form-data; name=%q", p.name)
+		if p.fileName != "" {
+			cd += fmt.Sprintf("; filename=%q", p.fileName)
+		}
+		h.Set("Content-Disposition", cd)
+		if p.contentType != "" {
+			h.Set("Content-Type", p.contentType)
+		}
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			t.Fatalf("mw.CreatePart(h) got err: %v", err)
+		}
+		io.WriteString(w, p.content)
+	}
+	mw.Close()
+	r := safehttptest.NewRequest(safehttp.MethodPost, "/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+var testUploadSpec = safehttp.UploadSpec{
+	Types: map[string][]string{
+		"image/png":                {".png"},
+		"text/plain":               {".txt"},
+		"text/csv":                 {".csv"},
+		"application/octet-stream": {".bin"},
+	},
+	MaxFiles:    3,
+	MaxFileSize: 16,
+}
+
+func TestMultipartReader(t *testing.T) {
+	r := newMultipartRequest(t,
+		testPart{name: "title", content: "Pizza"},
+		testPart{name: "image", fileName: "pizza.PNG", contentType: "image/png", content: pngHeader + "pizza"},
+		testPart{name: "notes", fileName: "notes.txt", contentType: "text/plain; charset=utf-8", content: "margherita"},
+		testPart{name: "prices", fileName: "prices.csv", contentType: "text/csv", content: "pizza,8"},
+	)
+
+	mr, err := r.MultipartReader(testUploadSpec)
+	if err != nil {
+		t.Fatalf("r.MultipartReader(testUploadSpec) got err: %v want: nil", err)
+	}
+
+	type part struct {
+		FormName, FileName, ContentType, Content string
+	}
+	var got []part
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("mr.NextPart() got err: %v want: nil", err)
+		}
+		b, err := io.ReadAll(p)
+		if err != nil {
+			t.Fatalf("io.ReadAll(p) got err: %v want: nil", err)
+		}
+		got = append(got, part{p.FormName(), p.FileName(), p.ContentType(), string(b)})
+	}
+
+	want := []part{
+		{FormName: "title", Content: "Pizza"},
+		{FormName: "image", FileName: "pizza.PNG", ContentType: "image/png", Content: pngHeader + "pizza"},
+		{FormName: "notes", FileName: "notes.txt", ContentType: "text/plain", Content: "margherita"},
+		{FormName: "prices", FileName: "prices.csv", ContentType: "text/csv", Content: "pizza,8"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestMultipartReaderInvalidFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		parts    []testPart
+		wantCode safehttp.StatusCode
+	}{
+		{
+			name: "Declared type not allowed",
+			parts: []testPart{
+				{name: "f", fileName: "page.html", contentType: "text/html", content: "<html>"},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Sniffed type not allowed",
+			parts: []testPart{
+				{name: "f", fileName: "pizza.png", contentType: "image/png", content: "<html><script>"},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Sniffed type allowed but different from declared type",
+			parts: []testPart{
+				{name: "f", fileName: "pizza.png", contentType: "image/png", content: "margherita"},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Sniffed type not equivalent to declared type",
+			parts: []testPart{
+				{name: "f", fileName: "notes.txt", contentType: "text/plain", content: pngHeader},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Extension mismatch",
+			parts: []testPart{
+				{name: "f", fileName: "pizza.html", contentType: "image/png", content: pngHeader},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Missing extension",
+			parts: []testPart{
+				{name: "f", fileName: "pizza", contentType: "image/png", content: pngHeader},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Missing content type defaults to octet-stream",
+			parts: []testPart{
+				{name: "f", fileName: "pizza.png", content: pngHeader},
+			},
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Too many files",
+			parts: []testPart{
+				{name: "f", fileName: "a.txt", contentType: "text/plain", content: "a"},
+				{name: "f", fileName: "b.txt", contentType: "text/plain", content: "b"},
+				{name: "f", fileName: "c.txt", contentType: "text/plain", content: "c"},
+				{name: "f", fileName: "d.txt", contentType: "text/plain", content: "d"},
+			},
+			wantCode: safehttp.StatusRequestEntityTooLarge,
+		},
+		{
+			name: "File too large",
+			parts: []testPart{
+				{name: "f", fileName: "a.txt", contentType: "text/plain", content: strings.Repeat("a", 17)},
+			},
+			wantCode: safehttp.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newMultipartRequest(t, tt.parts...)
+			mr, err := r.MultipartReader(testUploadSpec)
+			if err != nil {
+				t.Fatalf("r.MultipartReader(testUploadSpec) got err: %v want: nil", err)
+			}
+
+			for err == nil {
+				var p *safehttp.Part
+				p, err = mr.NextPart()
+				if err == nil {
+					_, err = io.ReadAll(p)
+				}
+			}
+			var re *safehttp.RequestError
+			if !errors.As(err, &re) {
+				t.Fatalf("got err: %v want: *safehttp.RequestError", err)
+			}
+			if re.Code != tt.wantCode {
+				t.Errorf("re.Code got: %v want: %v", re.Code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestMultipartReaderFileAtSizeLimit(t *testing.T) {
+	r := newMultipartRequest(t, testPart{name: "f", fileName: "a.txt", contentType: "text/plain", content: strings.Repeat("a", 16)})
+	mr, err := r.MultipartReader(testUploadSpec)
+	if err != nil {
+		t.Fatalf("r.MultipartReader(testUploadSpec) got err: %v want: nil", err)
+	}
+	p, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("mr.NextPart() got err: %v want: nil", err)
+	}
+	if _, err := io.ReadAll(p); err != nil {
+		t.Errorf("io.ReadAll(p) got err: %v want: nil", err)
+	}
+}
+
+func TestMultipartReaderInvalidRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      *safehttp.IncomingRequest
+		wantCode safehttp.StatusCode
+	}{
+		{
+			name:     "GET method",
+			req:      safehttptest.NewRequest(safehttp.MethodGet, "/", nil),
+			wantCode: safehttp.StatusBadRequest,
+		},
+		{
+			name: "Wrong content type",
+			req: func() *safehttp.IncomingRequest {
+				r := safehttptest.NewRequest(safehttp.MethodPost, "/", nil)
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				return r
+			}(),
+			wantCode: safehttp.StatusUnsupportedMediaType,
+		},
+		{
+			name: "Form already parsed",
+			req: func() *safehttp.IncomingRequest {
+				r := newMultipartRequest(t, testPart{name: "a", content: "b"})
+				r.MultipartForm(1024)
+				return r
+			}(),
+			wantCode: safehttp.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.req.MultipartReader(testUploadSpec)
+			var re *safehttp.RequestError
+			if !errors.As(err, &re) {
+				t.Fatalf("tt.req.MultipartReader(testUploadSpec) got err: %v want: *safehttp.RequestError", err)
+			}
+			if re.Code != tt.wantCode {
+				t.Errorf("re.Code got: %v want: %v", re.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -21,17 +21,27 @@ import (
 // URL represents a parsed URL (technically, a URI reference).
 type URL struct {
 	url *url.URL
+	// formSpec is the FormSpec of the route serving the request, if any.
+	formSpec *FormSpec
 }
 
 // Query parses the query string in the URL and returns a form
 // containing its values. The returned error describes the first
-// decoding error encountered, if any.
+// decoding error encountered, if any. If the request is served by a route
+// registered with a FormSpec, an error is also returned if the query doesn't
+// satisfy it.
 func (u URL) Query() (Form, error) {
 	v, err := url.ParseQuery(u.url.RawQuery)
 	if err != nil {
 		return Form{}, err
 	}
-	return Form{values: map[string][]string(v)}, nil
+	f := Form{values: map[string][]string(v)}
+	if u.formSpec != nil {
+		if err := f.Check(*u.formSpec); err != nil {
+			return Form{}, err
+		}
+	}
+	return f, nil
 }
 
 // String reassembles the URL into a valid URL string.
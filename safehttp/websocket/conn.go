@@ -0,0 +1,286 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+)
+
+// MessageType is the type of a WebSocket message.
+type MessageType int
+
+const (
+	// TextMessage is a message containing UTF-8 encoded text.
+	TextMessage MessageType = 1
+	// BinaryMessage is a message containing binary data.
+	BinaryMessage MessageType = 2
+)
+
+// Opcodes, see RFC 6455, section 5.2.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// Close status codes, see RFC 6455, section 7.4.1.
+const (
+	closeNormal        = 1000
+	closeProtocolError = 1002
+	closeInvalidData   = 1007
+	closeTooBig        = 1009
+)
+
+// maxControlPayload is the maximum payload size of control frames.
+const maxControlPayload = 125
+
+// errClosed is returned when writing to a closed connection.
+var errClosed = errors.New("websocket: connection closed")
+
+// Conn is a server-side WebSocket connection. Messages can be read by a single
+// goroutine at a time, while they can be written concurrently.
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	max  int64
+
+	// mu guards writes to the connection.
+	mu     sync.Mutex
+	closed bool
+}
+
+func newConn(conn net.Conn, r *bufio.Reader, max int64) *Conn {
+	return &Conn{conn: conn, r: r, max: max}
+}
+
+// ReadMessage reads the next message sent by the client. Ping frames are
+// answered automatically while reading. ReadMessage returns io.EOF once the
+// client has closed the connection.
+//
+// If the client violates the protocol, e.g. by sending a message larger than
+// the maximum message size or a text message that isn't valid UTF-8, the
+// connection is closed and an error is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		msgType MessageType
+		msg     []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame(int64(len(msg)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			code := closeNormal
+			switch {
+			case len(payload) == 1:
+				return 0, nil, c.fail(closeProtocolError, errors.New("websocket: invalid close frame"))
+			case len(payload) >= 2:
+				code = int(binary.BigEndian.Uint16(payload))
+				if !validCloseCode(code) {
+					return 0, nil, c.fail(closeProtocolError, fmt.Errorf("websocket: invalid close code %d", code))
+				}
+			}
+			c.closeWith(code)
+			return 0, nil, io.EOF
+		case opText, opBinary:
+			if msgType != 0 {
+				return 0, nil, c.fail(closeProtocolError, errors.New("websocket: new message before the end of the previous one"))
+			}
+			msgType = MessageType(op)
+		case opContinuation:
+			if msgType == 0 {
+				return 0, nil, c.fail(closeProtocolError, errors.New("websocket: continuation frame without a message"))
+			}
+		default:
+			return 0, nil, c.fail(closeProtocolError, fmt.Errorf("websocket: unknown opcode %#x", op))
+		}
+
+		msg = append(msg, payload...)
+		if !fin {
+			continue
+		}
+		if msgType == TextMessage && !utf8.Valid(msg) {
+			return 0, nil, c.fail(closeInvalidData, errors.New("websocket: text message is not valid UTF-8"))
+		}
+		return msgType, msg, nil
+	}
+}
+
+// readFrame reads a single frame, see RFC 6455, section 5.2. read is the size
+// of the message the frame is part of read so far.
+func (c *Conn) readFrame(read int64) (fin bool, op byte, payload []byte, err error) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.r, h[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = h[0]&0x80 != 0
+	op = h[0] & 0x0F
+	if h[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(closeProtocolError, errors.New("websocket: reserved bits set"))
+	}
+	if h[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(closeProtocolError, errors.New("websocket: unmasked client frame"))
+	}
+
+	n := int64(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+		u := binary.BigEndian.Uint64(b[:])
+		if u>>63 != 0 {
+			return false, 0, nil, c.fail(closeProtocolError, errors.New("websocket: invalid payload length"))
+		}
+		n = int64(u)
+	}
+
+	if op&0x8 != 0 {
+		if !fin || n > maxControlPayload {
+			return false, 0, nil, c.fail(closeProtocolError, errors.New("websocket: invalid control frame"))
+		}
+	} else if n > c.max-read {
+		// read is at most c.max, so c.max-read can't overflow, unlike read+n
+		// with a length sent by the client.
+		return false, 0, nil, c.fail(closeTooBig, fmt.Errorf("websocket: message larger than %d bytes", c.max))
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// WriteMessage sends a message to the client. Text messages must be valid
+// UTF-8.
+func (c *Conn) WriteMessage(t MessageType, data []byte) error {
+	switch t {
+	case TextMessage:
+		if !utf8.Valid(data) {
+			return errors.New("websocket: text message is not valid UTF-8")
+		}
+	case BinaryMessage:
+	default:
+		return fmt.Errorf("websocket: invalid message type %d", t)
+	}
+	return c.writeFrame(byte(t), data)
+}
+
+// writeFrame sends a single, unmasked, final frame.
+func (c *Conn) writeFrame(op byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+
+	h := make([]byte, 2, 10+len(payload))
+	h[0] = 0x80 | op
+	switch n := len(payload); {
+	case n <= maxControlPayload:
+		h[1] = byte(n)
+	case n <= 0xFFFF:
+		h[1] = 126
+		h = append(h, 0, 0)
+		binary.BigEndian.PutUint16(h[2:], uint16(n))
+	default:
+		h[1] = 127
+		h = append(h, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(h[2:], uint64(n))
+	}
+	_, err := c.conn.Write(append(h, payload...))
+	return err
+}
+
+// Close sends a close frame to the client and closes the connection.
+func (c *Conn) Close() error {
+	return c.closeWith(closeNormal)
+}
+
+// closeWith sends a close frame with the given status code, unless one has
+// already been sent, and closes the connection. Codes that can't be sent in a
+// close frame are replaced by closeNormal.
+func (c *Conn) closeWith(code int) error {
+	if !validCloseCode(code) {
+		code = closeNormal
+	}
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(code))
+	// The client might already be gone, the connection is closed regardless.
+	c.writeFrame(opClose, b[:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.conn.Close()
+}
+
+// validCloseCode reports whether code can be sent in a close frame. The codes
+// 1005, 1006 and 1015 are reserved for reporting the absence of a status code,
+// an abnormal closure and a TLS failure, and must never be sent. See RFC 6455,
+// section 7.4.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+	return false
+}
+
+// fail closes the connection with the given status code and returns err.
+func (c *Conn) fail(code int, err error) error {
+	c.closeWith(code)
+	return err
+}
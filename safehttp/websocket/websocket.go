@@ -0,0 +1,167 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package websocket implements the server side of the WebSocket protocol, as
+// specified in RFC 6455, on top of safehttp.
+//
+// Since browsers allow any website to open WebSocket connections to any
+// server, sending along the cookies of the server, upgrades are protected
+// against Cross-Site WebSocket Hijacking: the Origin of the request must be
+// explicitly allowed, cross-site requests are rejected based on Fetch Metadata
+// and an XSRF token can optionally be required.
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/xsrf"
+)
+
+// acceptGUID is used to compute the Sec-WebSocket-Accept header, see RFC 6455,
+// section 1.3.
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultMaxMessageSize is the maximum size of a message when none is
+// configured.
+const defaultMaxMessageSize = 1 << 20
+
+// Config configures the upgrade of a request to the WebSocket protocol.
+type Config struct {
+	// AllowedOrigins is the list of origins, e.g. "https://example.com",
+	// allowed to open WebSocket connections. Requests without an Origin
+	// header or with an Origin not in the list are rejected. If the list is
+	// empty, all requests are rejected.
+	AllowedOrigins []string
+
+	// XSRF, if set, is used to verify the XSRF token that must be sent in the
+	// query of the request under the xsrf.TokenKey key. The token has to be
+	// generated for the method and path of the WebSocket endpoint, e.g. using
+	// xsrf.Interceptor.TokenFor.
+	XSRF *xsrf.Interceptor
+
+	// MaxMessageSize is the maximum size in bytes of the messages received on
+	// the connection. If zero, a limit of 1 MiB is used.
+	MaxMessageSize int64
+}
+
+// Upgrade upgrades the request to the WebSocket protocol and returns the
+// resulting connection, which must be closed by the caller.
+//
+// If the request isn't a valid WebSocket upgrade request, or if it isn't
+// allowed by the Config, an error response is written and an error is
+// returned. In that case the handler should return without writing anything
+// else.
+func Upgrade(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest, cfg Config) (*Conn, error) {
+	key, err := checkHandshake(r)
+	if err != nil {
+		w.WriteError(safehttp.StatusBadRequest)
+		return nil, err
+	}
+	if err := cfg.checkOrigin(r); err != nil {
+		w.WriteError(safehttp.StatusForbidden)
+		return nil, err
+	}
+	if cfg.XSRF != nil {
+		f, err := r.URL.Query()
+		if err != nil {
+			w.WriteError(safehttp.StatusBadRequest)
+			return nil, err
+		}
+		tok := f.String(xsrf.TokenKey, "")
+		if f.Err() != nil || tok == "" {
+			w.WriteError(safehttp.StatusUnauthorized)
+			return nil, errors.New("missing xsrf token")
+		}
+		if err := cfg.XSRF.VerifyToken(r, tok); err != nil {
+			w.WriteError(safehttp.StatusForbidden)
+			return nil, err
+		}
+	}
+
+	h := w.Header()
+	h.Set("Upgrade", "websocket")
+	h.Set("Connection", "Upgrade")
+	h.Set("Sec-WebSocket-Accept", acceptKey(key))
+	conn, brw, err := w.SwitchProtocols()
+	if err != nil {
+		return nil, err
+	}
+
+	max := cfg.MaxMessageSize
+	if max == 0 {
+		max = defaultMaxMessageSize
+	}
+	return newConn(conn, brw.Reader, max), nil
+}
+
+// checkHandshake checks that the request is a valid opening handshake, see RFC
+// 6455, section 4.2.1, and returns its Sec-WebSocket-Key.
+func checkHandshake(r *safehttp.IncomingRequest) (string, error) {
+	if r.Method() != safehttp.MethodGet {
+		return "", fmt.Errorf("invalid method %q", r.Method())
+	}
+	if !headerContainsToken(r.Header.Values("Connection"), "upgrade") {
+		return "", errors.New(`missing "upgrade" token in the Connection header`)
+	}
+	if !headerContainsToken(r.Header.Values("Upgrade"), "websocket") {
+		return "", errors.New(`missing "websocket" token in the Upgrade header`)
+	}
+	if v := r.Header.Get("Sec-WebSocket-Version"); v != "13" {
+		return "", fmt.Errorf("unsupported WebSocket version %q", v)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return "", fmt.Errorf("invalid Sec-WebSocket-Key %q", key)
+	}
+	return key, nil
+}
+
+// checkOrigin rejects cross-site requests and requests from origins that
+// aren't explicitly allowed.
+func (cfg Config) checkOrigin(r *safehttp.IncomingRequest) error {
+	if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return errors.New("cross-site WebSocket upgrade")
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return errors.New("missing Origin header")
+	}
+	for _, o := range cfg.AllowedOrigins {
+		if strings.EqualFold(o, origin) {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q is not allowed", origin)
+}
+
+func headerContainsToken(values []string, token string) bool {
+	for _, v := range values {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
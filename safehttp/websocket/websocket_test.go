@@ -0,0 +1,448 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/xsrf"
+	"github.com/google/go-safeweb/safehttp/safehttptest"
+)
+
+type userIdentifier struct{}
+
+func (userIdentifier) UserID(r *safehttp.IncomingRequest) (string, error) {
+	return "1234", nil
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3.
+	if got, want := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf(`acceptKey("dGhlIHNhbXBsZSBub25jZQ==") got: %q want: %q`, got, want)
+	}
+}
+
+func newUpgradeRequest(target string) *safehttp.IncomingRequest {
+	r := safehttptest.NewRequest(safehttp.MethodGet, target, nil)
+	r.Header.Set("Connection", "keep-alive, Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	r.Header.Set("Sec-WebSocket-Version", "13")
+	r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	r.Header.Set("Origin", "https://foo.com")
+	return r
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	xsrfInterceptor := &xsrf.Interceptor{SecretAppKey: "testSecretAppKey", Identifier: userIdentifier{}}
+	tests := []struct {
+		name       string
+		cfg        Config
+		target     string
+		modify     func(r *safehttp.IncomingRequest)
+		wantStatus safehttp.StatusCode
+	}{
+		{
+			name:       "No allowed origins",
+			cfg:        Config{},
+			wantStatus: safehttp.StatusForbidden,
+		},
+		{
+			name:       "Origin not allowed",
+			cfg:        Config{AllowedOrigins: []string{"https://bar.com"}},
+			wantStatus: safehttp.StatusForbidden,
+		},
+		{
+			name: "Missing Origin",
+			cfg:  Config{AllowedOrigins: []string{"https://foo.com"}},
+			modify: func(r *safehttp.IncomingRequest) {
+				r.Header.Del("Origin")
+			},
+			wantStatus: safehttp.StatusForbidden,
+		},
+		{
+			name: "Cross-site request",
+			cfg:  Config{AllowedOrigins: []string{"https://foo.com"}},
+			modify: func(r *safehttp.IncomingRequest) {
+				r.Header.Set("Sec-Fetch-Site", "cross-site")
+			},
+			wantStatus: safehttp.StatusForbidden,
+		},
+		{
+			name: "Not an upgrade",
+			cfg:  Config{AllowedOrigins: []string{"https://foo.com"}},
+			modify: func(r *safehttp.IncomingRequest) {
+				r.Header.Set("Connection", "keep-alive")
+			},
+			wantStatus: safehttp.StatusBadRequest,
+		},
+		{
+			name: "Other protocol",
+			cfg:  Config{AllowedOrigins: []string{"https://foo.com"}},
+			modify: func(r *safehttp.IncomingRequest) {
+				r.Header.Set("Upgrade", "h2c")
+			},
+			wantStatus: safehttp.StatusBadRequest,
+		},
+		{
+			name: "Unsupported version",
+			cfg:  Config{AllowedOrigins: []string{"https://foo.com"}},
+			modify: func(r *safehttp.IncomingRequest) {
+				r.Header.Set("Sec-WebSocket-Version", "8")
+			},
+			wantStatus: safehttp.StatusBadRequest,
+		},
+		{
+			name: "Invalid key",
+			cfg:  Config{AllowedOrigins: []string{"https://foo.com"}},
+			modify: func(r *safehttp.IncomingRequest) {
+				r.Header.Set("Sec-WebSocket-Key", "c2hvcnQ=")
+			},
+			wantStatus: safehttp.StatusBadRequest,
+		},
+		{
+			name:       "Missing XSRF token",
+			cfg:        Config{AllowedOrigins: []string{"https://foo.com"}, XSRF: xsrfInterceptor},
+			wantStatus: safehttp.StatusUnauthorized,
+		},
+		{
+			name:       "Invalid XSRF token",
+			cfg:        Config{AllowedOrigins: []string{"https://foo.com"}, XSRF: xsrfInterceptor},
+			target:     "https://foo.com/ws?xsrf-token=invalid",
+			wantStatus: safehttp.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "https://foo.com/ws"
+			}
+			r := newUpgradeRequest(target)
+			if tt.modify != nil {
+				tt.modify(r)
+			}
+			rec := safehttptest.NewResponseRecorder()
+
+			conn, err := Upgrade(rec.ResponseWriter, r, tt.cfg)
+			if err == nil {
+				conn.Close()
+				t.Fatal("Upgrade() got: nil want: error")
+			}
+			if got := rec.Status(); got != tt.wantStatus {
+				t.Errorf("rec.Status() got: %v want: %v", got, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// client is a minimal WebSocket client used for testing.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, addr, path string, header http.Header) (*client, *http.Response) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("net.Dial() got err: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+path, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest() got err: %v", err)
+	}
+	req.Header = header
+	if err := req.Write(conn); err != nil {
+		t.Fatalf("req.Write() got err: %v", err)
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatalf("http.ReadResponse() got err: %v", err)
+	}
+	return &client{conn: conn, r: r}, resp
+}
+
+func (c *client) writeFrame(t *testing.T, fin bool, op byte, payload []byte) {
+	t.Helper()
+	var b bytes.Buffer
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	b.WriteByte(b0)
+	switch n := len(payload); {
+	case n <= 125:
+		b.WriteByte(0x80 | byte(n))
+	case n <= 0xFFFF:
+		b.WriteByte(0x80 | 126)
+		binary.Write(&b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(0x80 | 127)
+		binary.Write(&b, binary.BigEndian, uint64(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	b.Write(mask)
+	for i, p := range payload {
+		b.WriteByte(p ^ mask[i%4])
+	}
+	if _, err := c.conn.Write(b.Bytes()); err != nil {
+		t.Fatalf("c.conn.Write() got err: %v", err)
+	}
+}
+
+// writeFrameHeader writes the header of a frame declaring a payload of n bytes,
+// without writing the payload.
+func (c *client) writeFrameHeader(t *testing.T, fin bool, op byte, n uint64) {
+	t.Helper()
+	var b bytes.Buffer
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	b.WriteByte(b0)
+	b.WriteByte(0x80 | 127)
+	binary.Write(&b, binary.BigEndian, n)
+	b.Write([]byte{1, 2, 3, 4})
+	if _, err := c.conn.Write(b.Bytes()); err != nil {
+		t.Fatalf("c.conn.Write() got err: %v", err)
+	}
+}
+
+func (c *client) readFrame(t *testing.T) (op byte, payload []byte) {
+	t.Helper()
+	var h [2]byte
+	if _, err := io.ReadFull(c.r, h[:]); err != nil {
+		t.Fatalf("reading frame header got err: %v", err)
+	}
+	n := int(h[1] & 0x7F)
+	switch n {
+	case 126:
+		var l uint16
+		binary.Read(c.r, binary.BigEndian, &l)
+		n = int(l)
+	case 127:
+		var l uint64
+		binary.Read(c.r, binary.BigEndian, &l)
+		n = int(l)
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		t.Fatalf("reading frame payload got err: %v", err)
+	}
+	return h[0] & 0x0F, payload
+}
+
+// newEchoServer starts a server echoing all the messages it receives over
+// WebSocket connections upgraded at /ws.
+func newEchoServer(t *testing.T, cfg Config) (addr string, closeServer func()) {
+	srv := httptest.NewUnstartedServer(nil)
+	addr = srv.Listener.Addr().String()
+	mux := safehttp.NewServeMux(nil, addr)
+	mux.Handle("/ws", safehttp.MethodGet, safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		conn, err := Upgrade(w, r, cfg)
+		if err != nil {
+			return safehttp.Result{}
+		}
+		defer conn.Close()
+		for {
+			t, msg, err := conn.ReadMessage()
+			if err != nil {
+				return safehttp.Result{}
+			}
+			if err := conn.WriteMessage(t, msg); err != nil {
+				return safehttp.Result{}
+			}
+		}
+	}))
+	srv.Config.Handler = mux
+	srv.Start()
+	return addr, srv.Close
+}
+
+func upgradeHeader() http.Header {
+	return http.Header{
+		"Connection":            {"Upgrade"},
+		"Upgrade":               {"websocket"},
+		"Sec-Websocket-Version": {"13"},
+		"Sec-Websocket-Key":     {"dGhlIHNhbXBsZSBub25jZQ=="},
+		"Origin":                {"https://foo.com"},
+	}
+}
+
+func TestUpgradeEcho(t *testing.T) {
+	addr, closeServer := newEchoServer(t, Config{AllowedOrigins: []string{"https://foo.com"}})
+	defer closeServer()
+
+	c, resp := dial(t, addr, "/ws", upgradeHeader())
+	defer c.conn.Close()
+
+	if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+		t.Fatalf("resp.StatusCode got: %v want: %v", got, want)
+	}
+	if got, want := resp.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="; got != want {
+		t.Errorf(`resp.Header.Get("Sec-WebSocket-Accept") got: %q want: %q`, got, want)
+	}
+
+	c.writeFrame(t, true, opText, []byte("hello"))
+	if op, payload := c.readFrame(t); op != opText || string(payload) != "hello" {
+		t.Errorf("c.readFrame() got: %#x %q want: %#x %q", op, payload, opText, "hello")
+	}
+
+	c.writeFrame(t, false, opBinary, []byte("frag"))
+	c.writeFrame(t, true, opPing, []byte("ping"))
+	if op, payload := c.readFrame(t); op != opPong || string(payload) != "ping" {
+		t.Errorf("c.readFrame() got: %#x %q want: %#x %q", op, payload, opPong, "ping")
+	}
+	c.writeFrame(t, true, opContinuation, []byte("mented"))
+	if op, payload := c.readFrame(t); op != opBinary || string(payload) != "fragmented" {
+		t.Errorf("c.readFrame() got: %#x %q want: %#x %q", op, payload, opBinary, "fragmented")
+	}
+
+	long := bytes.Repeat([]byte("a"), 70000)
+	c.writeFrame(t, true, opBinary, long)
+	if op, payload := c.readFrame(t); op != opBinary || !bytes.Equal(payload, long) {
+		t.Errorf("c.readFrame() got: %#x with %d bytes want: %#x with %d bytes", op, len(payload), opBinary, len(long))
+	}
+
+	c.writeFrame(t, true, opClose, []byte{0x03, 0xE8})
+	if op, payload := c.readFrame(t); op != opClose || binary.BigEndian.Uint16(payload) != closeNormal {
+		t.Errorf("c.readFrame() got: %#x %v want: %#x %v", op, payload, opClose, closeNormal)
+	}
+}
+
+func TestUpgradeProtocolErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		write     func(t *testing.T, c *client)
+		wantClose uint16
+	}{
+		{
+			name: "Message too big",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, true, opBinary, bytes.Repeat([]byte("a"), 11))
+			},
+			wantClose: closeTooBig,
+		},
+		{
+			name: "Fragmented message too big",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, false, opBinary, bytes.Repeat([]byte("a"), 6))
+				c.writeFrame(t, true, opContinuation, bytes.Repeat([]byte("a"), 6))
+			},
+			wantClose: closeTooBig,
+		},
+		{
+			name: "Fragmented message with huge length",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, false, opText, []byte("aaaaa"))
+				c.writeFrameHeader(t, true, opContinuation, 1<<63-5)
+			},
+			wantClose: closeTooBig,
+		},
+		{
+			name: "One byte close payload",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, true, opClose, []byte{0x03})
+			},
+			wantClose: closeProtocolError,
+		},
+		{
+			name: "Reserved close code",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, true, opClose, []byte{0x03, 0xED}) // 1005
+			},
+			wantClose: closeProtocolError,
+		},
+		{
+			name: "Invalid UTF-8",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, true, opText, []byte{0xff, 0xfe})
+			},
+			wantClose: closeInvalidData,
+		},
+		{
+			name: "Unexpected continuation",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, true, opContinuation, []byte("a"))
+			},
+			wantClose: closeProtocolError,
+		},
+		{
+			name: "Unknown opcode",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, true, 0x3, []byte("a"))
+			},
+			wantClose: closeProtocolError,
+		},
+		{
+			name: "Fragmented control frame",
+			write: func(t *testing.T, c *client) {
+				c.writeFrame(t, false, opPing, []byte("a"))
+			},
+			wantClose: closeProtocolError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := newEchoServer(t, Config{AllowedOrigins: []string{"https://foo.com"}, MaxMessageSize: 10})
+			defer closeServer()
+
+			c, resp := dial(t, addr, "/ws", upgradeHeader())
+			defer c.conn.Close()
+			if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+				t.Fatalf("resp.StatusCode got: %v want: %v", got, want)
+			}
+
+			tt.write(t, c)
+			op, payload := c.readFrame(t)
+			if op != opClose || len(payload) < 2 || binary.BigEndian.Uint16(payload) != tt.wantClose {
+				t.Errorf("c.readFrame() got: %#x %v want: close frame with code %v", op, payload, tt.wantClose)
+			}
+		})
+	}
+}
+
+func TestUpgradeXSRF(t *testing.T) {
+	i := &xsrf.Interceptor{SecretAppKey: "testSecretAppKey", Identifier: userIdentifier{}}
+	addr, closeServer := newEchoServer(t, Config{AllowedOrigins: []string{"https://foo.com"}, XSRF: i})
+	defer closeServer()
+
+	tok, err := i.TokenFor(safehttptest.NewRequest(safehttp.MethodGet, "/chat", nil), safehttp.MethodGet, "/ws")
+	if err != nil {
+		t.Fatalf("i.TokenFor() got err: %v want: nil", err)
+	}
+
+	c, resp := dial(t, addr, "/ws?"+xsrf.TokenKey+"="+tok, upgradeHeader())
+	defer c.conn.Close()
+	if got, want := resp.StatusCode, http.StatusSwitchingProtocols; got != want {
+		t.Fatalf("resp.StatusCode got: %v want: %v", got, want)
+	}
+
+	c.writeFrame(t, true, opText, []byte("hello"))
+	if op, payload := c.readFrame(t); op != opText || string(payload) != "hello" {
+		t.Errorf("c.readFrame() got: %#x %q want: %#x %q", op, payload, opText, "hello")
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// 	https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fetchmetadata_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-safeweb/safehttp"
+	"github.com/google/go-safeweb/safehttp/plugins/fetch_metadata"
+	"github.com/google/safehtml"
+)
+
+type dispatcher struct{}
+
+func (dispatcher) Write(rw http.ResponseWriter, resp safehttp.Response) error {
+	switch x := resp.(type) {
+	case safehtml.HTML:
+		_, err := rw.Write([]byte(x.String()))
+		return err
+	default:
+		panic("not a safe response type")
+	}
+}
+
+func (dispatcher) ExecuteTemplate(rw http.ResponseWriter, t safehttp.Template, data interface{}) error {
+	return nil
+}
+
+type responseRecorder struct {
+	header http.Header
+	writer io.Writer
+	status safehttp.StatusCode
+}
+
+func newResponseRecorder(w io.Writer) *responseRecorder {
+	return &responseRecorder{header: http.Header{}, writer: w, status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(statusCode int) {
+	r.status = safehttp.StatusCode(statusCode)
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	return r.writer.Write(data)
+}
+
+func TestServeMuxInstallFetchMetadataPerRouteConfig(t *testing.T) {
+	mux := safehttp.NewServeMux(dispatcher{}, "foo.com")
+
+	mux.Install(fetchmetadata.NewPlugin())
+	handler := safehttp.HandlerFunc(func(w *safehttp.ResponseWriter, r *safehttp.IncomingRequest) safehttp.Result {
+		return w.Write(safehtml.HTMLEscaped("<h1>Hello World!</h1>"))
+	})
+	mux.Handle("/protected", safehttp.MethodPost, handler)
+	mux.Handle("/embeddable", safehttp.MethodPost, handler, fetchmetadata.Config{AllowCrossSite: true})
+
+	tests := []struct {
+		path       string
+		wantStatus safehttp.StatusCode
+	}{
+		{path: "/protected", wantStatus: safehttp.StatusForbidden},
+		{path: "/embeddable", wantStatus: safehttp.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := newResponseRecorder(&strings.Builder{})
+			req := httptest.NewRequest(http.MethodPost, "https://foo.com"+tt.path, nil)
+			req.Header.Set("Sec-Fetch-Site", "cross-site")
+			req.Header.Set("Sec-Fetch-Mode", "no-cors")
+			req.Header.Set("Sec-Fetch-Dest", "image")
+
+			mux.ServeHTTP(rr, req)
+
+			if rr.status != tt.wantStatus {
+				t.Errorf("rr.status got: %v want: %v", rr.status, tt.wantStatus)
+			}
+		})
+	}
+}